@@ -17,13 +17,36 @@ limitations under the License.
 package v1
 
 import (
+	"encoding/json"
 	"log"
+	"maps"
 
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 
 	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
 )
 
+// hubSpecAnnotation carries the spec fields that only exist in the Hub version (v2) on a v1 object,
+// so that a v2 -> v1 -> v2 round trip does not lose them.
+const hubSpecAnnotation = "apps.wuyong.cn/v2-spec"
+
+// hubOnlySpec holds the spec fields that only exist in the Hub version (v2).
+type hubOnlySpec struct {
+	RolloutStrategy       *appsv2.RolloutStrategy       `json:"rolloutStrategy,omitempty"`
+	Autoscaling           *appsv2.AutoscalingSpec       `json:"autoscaling,omitempty"`
+	Disruption            *appsv2.DisruptionSpec        `json:"disruption,omitempty"`
+	Ingress               *appsv2.IngressSpec           `json:"ingress,omitempty"`
+	Routes                []appsv2.HTTPRouteSpec        `json:"routes,omitempty"`
+	Config                *appsv2.ConfigSpec            `json:"config,omitempty"`
+	Secrets               []appsv2.SecretReference      `json:"secrets,omitempty"`
+	RestartOnConfigChange bool                          `json:"restartOnConfigChange,omitempty"`
+	Identity              *appsv2.IdentitySpec          `json:"identity,omitempty"`
+	Network               *appsv2.NetworkSpec           `json:"network,omitempty"`
+	Workload              *appsv2.WorkloadSpec          `json:"workload,omitempty"`
+	Components            []appsv2.ComponentSpec        `json:"components,omitempty"`
+	DependsOn             []appsv2.ApplicationReference `json:"dependsOn,omitempty"`
+}
+
 // ConvertTo converts this Application (v1) to the Hub version (v2).
 func (src *Application) ConvertTo(dstRaw conversion.Hub) error {
 	dst := dstRaw.(*appsv2.Application)
@@ -40,10 +63,44 @@ func (src *Application) ConvertTo(dstRaw conversion.Hub) error {
 	// Spec
 	dst.Spec.Service = src.Spec.Service
 	dst.Spec.Workflow = src.Spec.Deployment
+	dst.Spec.ForceOwnership = src.Spec.ForceOwnership
+	dst.Spec.DeletionPolicy = src.Spec.DeletionPolicy
+	dst.Spec.RevisionHistoryLimit = src.Spec.RevisionHistoryLimit
+	dst.Spec.Suspend = src.Spec.Suspend
+
+	// Restore the v2 only fields carried in the annotation
+	if raw, ok := src.Annotations[hubSpecAnnotation]; ok {
+		hubSpec := hubOnlySpec{}
+		if err := json.Unmarshal([]byte(raw), &hubSpec); err != nil {
+			return err
+		}
+		dst.Spec.RolloutStrategy = hubSpec.RolloutStrategy
+		dst.Spec.Autoscaling = hubSpec.Autoscaling
+		dst.Spec.Disruption = hubSpec.Disruption
+		dst.Spec.Ingress = hubSpec.Ingress
+		dst.Spec.Routes = hubSpec.Routes
+		dst.Spec.Config = hubSpec.Config
+		dst.Spec.Secrets = hubSpec.Secrets
+		dst.Spec.RestartOnConfigChange = hubSpec.RestartOnConfigChange
+		dst.Spec.Identity = hubSpec.Identity
+		dst.Spec.Network = hubSpec.Network
+		dst.Spec.Workload = hubSpec.Workload
+		dst.Spec.Components = hubSpec.Components
+		dst.Spec.DependsOn = hubSpec.DependsOn
+		dst.Annotations = maps.Clone(src.Annotations)
+		delete(dst.Annotations, hubSpecAnnotation)
+	}
 
 	// Status
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Phase = src.Status.Phase
 	dst.Status.Network = src.Status.Network
 	dst.Status.Workflow = src.Status.Workflow
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.Selector = src.Status.Selector
+	dst.Status.Conflicts = src.Status.Conflicts
+	dst.Status.CurrentRevision = src.Status.CurrentRevision
 
 	return nil
 }
@@ -64,10 +121,49 @@ func (dst *Application) ConvertFrom(srcRaw conversion.Hub) error {
 	// Spec
 	dst.Spec.Deployment = src.Spec.Workflow
 	dst.Spec.Service = src.Spec.Service
+	dst.Spec.ForceOwnership = src.Spec.ForceOwnership
+	dst.Spec.DeletionPolicy = src.Spec.DeletionPolicy
+	dst.Spec.RevisionHistoryLimit = src.Spec.RevisionHistoryLimit
+	dst.Spec.Suspend = src.Spec.Suspend
+
+	// Carry the v2 only fields in an annotation
+	hubSpec := hubOnlySpec{
+		RolloutStrategy:       src.Spec.RolloutStrategy,
+		Autoscaling:           src.Spec.Autoscaling,
+		Disruption:            src.Spec.Disruption,
+		Ingress:               src.Spec.Ingress,
+		Routes:                src.Spec.Routes,
+		Config:                src.Spec.Config,
+		Secrets:               src.Spec.Secrets,
+		RestartOnConfigChange: src.Spec.RestartOnConfigChange,
+		Identity:              src.Spec.Identity,
+		Network:               src.Spec.Network,
+		Workload:              src.Spec.Workload,
+		Components:            src.Spec.Components,
+		DependsOn:             src.Spec.DependsOn,
+	}
+	raw, err := json.Marshal(hubSpec)
+	if err != nil {
+		return err
+	}
+	if string(raw) != "{}" {
+		dst.Annotations = maps.Clone(src.Annotations)
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[hubSpecAnnotation] = string(raw)
+	}
 
 	// Status
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Phase = src.Status.Phase
 	dst.Status.Network = src.Status.Network
 	dst.Status.Workflow = src.Status.Workflow
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.Selector = src.Status.Selector
+	dst.Status.Conflicts = src.Status.Conflicts
+	dst.Status.CurrentRevision = src.Status.CurrentRevision
 
 	return nil
 }
@@ -39,6 +39,29 @@ type ApplicationSpec struct {
 	// +kubebuilder:validation:Schemaless
 	Deployment shared.DeploymentTemplate `json:"deployment,omitempty"`
 	Service    shared.ServiceTemplate    `json:"service,omitempty"`
+
+	// ForceOwnership makes the operator take over fields of the generated children that are owned by
+	// other field managers when applying them. When false, such conflicts are reported in status.conflicts.
+	// +optional
+	ForceOwnership bool `json:"forceOwnership,omitempty"`
+
+	// DeletionPolicy decides what happens to the generated children when the Application is deleted.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy shared.DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// RevisionHistoryLimit is the number of rendered specs kept as ControllerRevisions for rollback.
+	// A rollback is requested with the apps.wuyong.cn/rollback-to annotation.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Suspend stops the operator from changing the generated children, e.g. while they are edited by hand
+	// during an incident. The status keeps being reported and the Suspended condition is set.
+	// Rollout and rollback requests are handled once the Application is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
 }
 
 // ApplicationStatus defines the observed state of Application.
@@ -57,12 +80,49 @@ type ApplicationStatus struct {
 	// - "Progressing": the resource is being created or updated
 	// - "Degraded": the resource failed to reach or maintain its desired state
 	//
+	// The status of each condition is one of True, False, or Unknown.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the .metadata.generation of the Application that was last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase summarizes the conditions of the Application.
+	// +optional
+	Phase shared.ApplicationPhase `json:"phase,omitempty"`
+
 	Workflow appsv1.DeploymentStatus `json:"workflow"`
 	Network  corev1.ServiceStatus    `json:"network"`
+
+	// Replicas is the number of running pods matched by the selector, including the pods of
+	// a canary or blue-green rollout, reported through the scale subresource.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Selector is the label selector of the pods of spec.workflow in string form, reported through the
+	// scale subresource so that autoscalers targeting the Application can find its pods.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// Conflicts lists the server-side apply conflicts hit while applying the generated children.
+	// +optional
+	Conflicts []shared.FieldConflict `json:"conflicts,omitempty"`
+
+	// CurrentRevision is the name of the ControllerRevision holding the spec that was last rendered.
+	// +optional
+	CurrentRevision string `json:"currentRevision,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.deployment.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.workflow.readyReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:resource:path=applications,singular=application,scope=Namespaced,shortName=app
 
 // Application is the Schema for the applications API
@@ -37,6 +37,91 @@ type ApplicationSpec struct {
 	// +kubebuilder:validation:Schemaless
 	Workflow shared.DeploymentTemplate `json:"workflow,omitempty"`
 	Service  shared.ServiceTemplate    `json:"service,omitempty"`
+
+	// Workload selects whether spec.workflow is rendered as a Deployment, a StatefulSet, a Job or a CronJob.
+	// +optional
+	Workload *WorkloadSpec `json:"workload,omitempty"`
+
+	// Components are additional workloads of the Application, each with its own Deployment and Service.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Components []ComponentSpec `json:"components,omitempty"`
+
+	// ForceOwnership makes the operator take over fields of the generated children that are owned by
+	// other field managers when applying them. When false, such conflicts are reported in status.conflicts.
+	// +optional
+	ForceOwnership bool `json:"forceOwnership,omitempty"`
+
+	// DeletionPolicy decides what happens to the generated children when the Application is deleted.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy shared.DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// RevisionHistoryLimit is the number of rendered specs kept as ControllerRevisions for rollback.
+	// A rollback is requested with the apps.wuyong.cn/rollback-to annotation.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Suspend stops the operator from changing the generated children, e.g. while they are edited by hand
+	// during an incident. The status keeps being reported and the Suspended condition is set.
+	// Rollout and rollback requests are handled once the Application is resumed.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// RolloutStrategy describes how changes of spec.workflow.template are rolled out.
+	// Manual actions are requested with the apps.wuyong.cn/rollout-action annotation.
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// Autoscaling renders a HorizontalPodAutoscaler for the workflow. It cannot be combined with the blueGreen strategy.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Disruption renders a PodDisruptionBudget for the pods of the Application.
+	// +optional
+	Disruption *DisruptionSpec `json:"disruption,omitempty"`
+
+	// Ingress renders an Ingress that routes external traffic to the Service.
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Routes renders Gateway API HTTPRoutes for the Application, as an alternative to spec.ingress.
+	// They require the Gateway API CRDs, the RoutesReady condition reports when they are missing.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Routes []HTTPRouteSpec `json:"routes,omitempty"`
+
+	// Config renders configuration files and environment variables into generated ConfigMaps for the workflow.
+	// +optional
+	Config *ConfigSpec `json:"config,omitempty"`
+
+	// Secrets are existing Secrets exposed to the workflow. Changes of their data roll the pods out.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Secrets []SecretReference `json:"secrets,omitempty"`
+
+	// Identity provisions the ServiceAccount the pods run as and binds Roles to it.
+	// +optional
+	Identity *IdentitySpec `json:"identity,omitempty"`
+
+	// Network renders a NetworkPolicy that only allows the declared traffic to and from the pods.
+	// +optional
+	Network *NetworkSpec `json:"network,omitempty"`
+
+	// DependsOn lists the Applications that must be Available before the workload of this Application is
+	// created or updated. The WaitingForDependencies condition lists the dependencies that are not Available yet.
+	// +optional
+	DependsOn []ApplicationReference `json:"dependsOn,omitempty"`
+
+	// RestartOnConfigChange rolls the pods out when the ConfigMaps and Secrets referenced by spec.workflow.template
+	// through volumes, envFrom or env change. The Secrets of spec.secrets are always watched.
+	// +optional
+	RestartOnConfigChange bool `json:"restartOnConfigChange,omitempty"`
 }
 
 // ApplicationStatus defines the observed state of Application.
@@ -56,13 +141,75 @@ type ApplicationStatus struct {
 	// - "Degraded": the resource failed to reach or maintain its desired state
 	//
 	// The status of each condition is one of True, False, or Unknown.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the .metadata.generation of the Application that was last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase summarizes the conditions of the Application.
+	// +optional
+	Phase shared.ApplicationPhase `json:"phase,omitempty"`
+
 	Workflow appsv1.DeploymentStatus `json:"workflow"`
 	Network  corev1.ServiceStatus    `json:"network"`
+
+	// Replicas is the number of running pods matched by the selector, including the pods of
+	// a canary or blue-green rollout, reported through the scale subresource.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Selector is the label selector of the pods of spec.workflow in string form, reported through the
+	// scale subresource so that autoscalers targeting the Application can find its pods.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// Conflicts lists the server-side apply conflicts hit while applying the generated children.
+	// +optional
+	Conflicts []shared.FieldConflict `json:"conflicts,omitempty"`
+
+	// CurrentRevision is the name of the ControllerRevision holding the spec that was last rendered.
+	// +optional
+	CurrentRevision string `json:"currentRevision,omitempty"`
+
+	// Rollout reports the progress of spec.rolloutStrategy.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Components reports the state of each component. The conditions and the phase aggregate spec.workflow
+	// and all components.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Batch reports the runs of a Job or CronJob workload.
+	// +optional
+	Batch *BatchStatus `json:"batch,omitempty"`
+
+	// PodFailures summarizes why pods of the Application or of its components are failing. Pods failing for the
+	// same reason in the same container are reported once, and at most 10 entries are kept.
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	PodFailures []PodFailure `json:"podFailures,omitempty"`
+
+	// URLs lists the addresses the Application is reachable at through the generated Ingress.
+	// +optional
+	URLs []string `json:"urls,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.workflow.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.workflow.readyReplicas`
+// +kubebuilder:printcolumn:name="Failure",type=string,JSONPath=`.status.podFailures[0].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:storageversion
 
 // Application is the Schema for the applications API
@@ -0,0 +1,63 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ComponentSpec describes an additional workload of the Application, e.g. the API and the worker next to the
+// frontend rendered from spec.workflow. Each component is rendered as a Deployment named <application>-<name>
+// and, when spec.service.ports is set, a Service with the same name. The rollout strategies, autoscaling,
+// disruption budget, ingress and network policy of the Application only apply to spec.workflow.
+// spec.config, spec.secrets and spec.identity are shared by all components.
+type ComponentSpec struct {
+	// Name of the component, used as the suffix of the names of its children.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=40
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Workflow is the Deployment of the component. Its selector is ignored, like the one of spec.workflow.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Workflow shared.DeploymentTemplate `json:"workflow,omitempty"`
+
+	// Service of the component. It is only generated when it declares ports.
+	// +optional
+	Service shared.ServiceTemplate `json:"service,omitempty"`
+}
+
+// ComponentStatus reports the observed state of a component.
+type ComponentStatus struct {
+	// Name of the component.
+	Name string `json:"name"`
+
+	// Phase summarizes the state of the Deployment of the component.
+	// +optional
+	Phase shared.ApplicationPhase `json:"phase,omitempty"`
+
+	// Workflow is the status of the Deployment of the component.
+	// +optional
+	Workflow appsv1.DeploymentStatus `json:"workflow,omitempty"`
+
+	// Network is the status of the Service of the component.
+	// +optional
+	Network corev1.ServiceStatus `json:"network,omitempty"`
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+// ConfigSpec describes the configuration generated for the Application. The operator renders it into
+// immutable ConfigMaps named after a hash of their content, so that every change of the configuration
+// rolls the pods out. Older generated ConfigMaps are kept for rollbacks up to historyLimit.
+type ConfigSpec struct {
+	// Files are mounted into every container of the workflow at mountPath, one file per key.
+	// +optional
+	Files map[string]string `json:"files,omitempty"`
+
+	// Env is exposed to every container of the workflow as environment variables.
+	// +optional
+	Env map[string]string `json:"env,omitempty"`
+
+	// MountPath is the directory the files are mounted at.
+	// +kubebuilder:default=/etc/config
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// HistoryLimit is the number of previously generated ConfigMaps kept for each of files and env.
+	// ConfigMaps still used by a running Deployment are never removed.
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// SecretReference refers to an existing Secret in the namespace of the Application. A checksum of its
+// data is stamped onto the pod template, so that rotating the Secret rolls the pods out.
+type SecretReference struct {
+	// Name of the Secret.
+	Name string `json:"name"`
+
+	// MountPath mounts the keys of the Secret as files into every container of the workflow.
+	// When empty, the keys are exposed as environment variables instead.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+// PodFailureReason is the kind of failure found on the pods of an Application.
+// +kubebuilder:validation:Enum=CrashLoopBackOff;ImagePullBackOff;OOMKilled;Unschedulable;ProbeFailed
+type PodFailureReason string
+
+const (
+	// PodFailureCrashLoopBackOff means a container keeps exiting and is restarted with a back-off.
+	// Containers killed by a failing liveness probe end up here as well.
+	PodFailureCrashLoopBackOff PodFailureReason = "CrashLoopBackOff"
+	// PodFailureImagePullBackOff means the image of a container cannot be pulled.
+	PodFailureImagePullBackOff PodFailureReason = "ImagePullBackOff"
+	// PodFailureOOMKilled means a container was killed because it exceeded its memory limit.
+	PodFailureOOMKilled PodFailureReason = "OOMKilled"
+	// PodFailureUnschedulable means the scheduler cannot find a node for the pod.
+	PodFailureUnschedulable PodFailureReason = "Unschedulable"
+	// PodFailureProbeFailed means a running container has not passed its readiness probe for longer than
+	// the probe allows.
+	PodFailureProbeFailed PodFailureReason = "ProbeFailed"
+)
+
+// PodFailure summarizes the pods of an Application that fail for the same reason in the same container.
+type PodFailure struct {
+	// Reason is the kind of the failure.
+	Reason PodFailureReason `json:"reason"`
+
+	// Component is the component the failing pods belong to. It is empty for the pods of spec.workflow.
+	// +optional
+	Component string `json:"component,omitempty"`
+
+	// Container is the name of the failing container. It is empty when the pod cannot be scheduled.
+	// +optional
+	Container string `json:"container,omitempty"`
+
+	// Pod is the name of one of the failing pods.
+	Pod string `json:"pod"`
+
+	// Pods is the number of pods with this failure.
+	Pods int32 `json:"pods"`
+
+	// RestartCount is the highest restart count of the container among the failing pods.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// Message is the last termination message of the container, or the message reported by Kubernetes.
+	// It is truncated to a few hundred characters.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DisruptionSpec describes the PodDisruptionBudget generated for the pods of the Application.
+// At most one of minAvailable and maxUnavailable may be set. When both are empty, maxUnavailable
+// defaults to a quarter of the replicas, but at least 1. The PodDisruptionBudget is removed while
+// the Application runs a single replica, so that node drains are not blocked.
+type DisruptionSpec struct {
+	// MinAvailable is the number or percentage of pods that must stay available during a voluntary disruption.
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of pods that may be unavailable during a voluntary disruption.
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
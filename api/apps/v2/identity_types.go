@@ -0,0 +1,56 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+// IdentitySpec describes the identity the pods of the Application run as. The pods use the ServiceAccount
+// named serviceAccountName, or the name of the Application when it is empty.
+type IdentitySpec struct {
+	// Create makes the operator create the ServiceAccount. When false, the ServiceAccount must already exist
+	// and serviceAccountName is required.
+	// +optional
+	Create bool `json:"create,omitempty"`
+
+	// ServiceAccountName is the name of the ServiceAccount. Defaults to the name of the Application.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// AutomountServiceAccountToken sets automountServiceAccountToken on the created ServiceAccount.
+	// +optional
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+
+	// ImagePullSecrets are names of existing Secrets used to pull the images. They are set on the created
+	// ServiceAccount, or on the pod template when the ServiceAccount is not created by the operator.
+	// +optional
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+
+	// Roles are bound to the ServiceAccount with RoleBindings in the namespace of the Application.
+	// ClusterRoles are bound in the namespace as well, they never grant cluster-wide access. The user creating or
+	// updating the Application must be allowed to bind every added role. Out of the box the operator itself
+	// may only bind the view and edit ClusterRoles.
+	// +optional
+	Roles []RoleReference `json:"roles,omitempty"`
+}
+
+// RoleReference refers to a Role in the namespace of the Application or to a ClusterRole.
+type RoleReference struct {
+	// +kubebuilder:validation:Enum=Role;ClusterRole
+	// +kubebuilder:default=Role
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	Name string `json:"name"`
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// IngressSpec describes the Ingress generated in front of the Service of the Application.
+type IngressSpec struct {
+	// IngressClassName selects the ingress controller. The cluster default is used when it is empty.
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// Annotations are added to the generated Ingress, e.g. for controller specific settings.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Hosts routes the listed hosts and paths to the Service.
+	// +kubebuilder:validation:MinItems=1
+	Hosts []IngressHost `json:"hosts"`
+
+	// TLSSecretName is the Secret holding the TLS certificate for all hosts. TLS is disabled when it is empty.
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// ServicePort is the name or number of the Service port traffic is sent to. Defaults to the first Service port,
+	// so the Ingress follows changes of the Service ports.
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	ServicePort *intstr.IntOrString `json:"servicePort,omitempty"`
+}
+
+// IngressHost routes a host to the Service.
+type IngressHost struct {
+	// Host is the fully qualified domain name. An empty host matches all requests.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Paths routed to the Service. Defaults to "/".
+	// +optional
+	Paths []IngressPath `json:"paths,omitempty"`
+}
+
+// IngressPath is a path of a host routed to the Service.
+type IngressPath struct {
+	// Path is matched against the path of an incoming request.
+	// +kubebuilder:default="/"
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// PathType decides how the path is matched. Defaults to Prefix.
+	// +kubebuilder:validation:Enum=Exact;Prefix;ImplementationSpecific
+	// +optional
+	PathType *networkingv1.PathType `json:"pathType,omitempty"`
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NetworkSpec describes the NetworkPolicy generated for the pods of the Application. A direction is
+// restricted when it declares peers or when defaultDeny is set. Traffic of a restricted direction is
+// only allowed to and from the declared peers.
+type NetworkSpec struct {
+	// DefaultDeny restricts both directions, so that traffic without a matching peer is denied.
+	// +optional
+	DefaultDeny bool `json:"defaultDeny,omitempty"`
+
+	// IngressFrom are the peers allowed to connect to the pods.
+	// +optional
+	IngressFrom []NetworkPeer `json:"ingressFrom,omitempty"`
+
+	// EgressTo are the peers the pods are allowed to connect to.
+	// +optional
+	EgressTo []NetworkPeer `json:"egressTo,omitempty"`
+
+	// AllowDNS allows DNS lookups on port 53 while egress is restricted.
+	// +kubebuilder:default=true
+	// +optional
+	AllowDNS *bool `json:"allowDNS,omitempty"`
+}
+
+// NetworkPeer is another Application, a namespace or a CIDR. Exactly one of application, namespace
+// without application, and cidr must be set.
+type NetworkPeer struct {
+	// Application is the name of another Application. Its pods are selected through the selector labels
+	// generated by the operator, so the peer follows the Application when it is recreated.
+	// +optional
+	Application string `json:"application,omitempty"`
+
+	// Namespace of the Application. Without application, all pods of the namespace are selected.
+	// Defaults to the namespace of this Application when application is set.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// CIDR is an IP block, e.g. 10.0.0.0/8.
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+
+	// Except are IP blocks excluded from cidr.
+	// +optional
+	Except []string `json:"except,omitempty"`
+
+	// Ports the traffic is allowed on. All ports are allowed when empty.
+	// +optional
+	Ports []NetworkPort `json:"ports,omitempty"`
+}
+
+// NetworkPort is a port and protocol the traffic is allowed on.
+type NetworkPort struct {
+	// +kubebuilder:default=TCP
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+
+	// Port is a port number or the name of a container port.
+	// +kubebuilder:validation:XIntOrString
+	Port intstr.IntOrString `json:"port"`
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RolloutStrategy describes how a new pod template of the workflow is rolled out.
+// When it is empty, the Deployment's own rolling update is used.
+type RolloutStrategy struct {
+	// Canary rolls the new pod template out to a separate canary Deployment behind the same Service,
+	// shifting traffic step by step by changing the replica ratio of the stable and canary Deployments.
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+
+	// BlueGreen rolls the new pod template out to the inactive color behind a preview Service and
+	// switches the main Service to it at once on promotion. It cannot be combined with canary.
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+}
+
+// CanaryStrategy is a list of steps executed in order. After the last step the canary is promoted:
+// the stable Deployment gets the new pod template and the canary Deployment is removed.
+type CanaryStrategy struct {
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+}
+
+// CanaryStep is a single canary step. Exactly one of setWeight and pause must be set.
+type CanaryStep struct {
+	// SetWeight is the percentage of replicas that run the new pod template.
+	// The step completes once the canary replicas are available.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	SetWeight *int32 `json:"setWeight,omitempty"`
+
+	// Pause holds the rollout. Without a duration it waits for the resume or promote action.
+	// +optional
+	Pause *CanaryPause `json:"pause,omitempty"`
+}
+
+// CanaryPause holds the rollout for a while.
+type CanaryPause struct {
+	// Duration of the pause, e.g. 5m. When empty, the rollout is paused until it is resumed manually.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// BlueGreenStrategy runs two Deployments, blue (named after the Application) and green (suffixed with -green).
+// The main Service selects the active color and the <name>-preview Service selects the other one.
+type BlueGreenStrategy struct {
+	// AutoPromotion switches the main Service to the new color as soon as all of its replicas are available.
+	// Otherwise the rollout waits for the promote action.
+	// +optional
+	AutoPromotion bool `json:"autoPromotion,omitempty"`
+
+	// ScaleDownDelay is how long the previous color keeps its replicas after promotion,
+	// so that traffic can be switched back instantly by restoring the previous pod template.
+	// +kubebuilder:default="30s"
+	// +optional
+	ScaleDownDelay *metav1.Duration `json:"scaleDownDelay,omitempty"`
+}
+
+// RolloutPhase summarizes the progress of a rollout.
+// +kubebuilder:validation:Enum=Healthy;Progressing;Paused;Aborted
+type RolloutPhase string
+
+const (
+	// RolloutHealthy means no rollout is in progress and the stable pod template serves all traffic.
+	RolloutHealthy RolloutPhase = "Healthy"
+	// RolloutProgressing means the rollout is shifting traffic to the new pod template.
+	RolloutProgressing RolloutPhase = "Progressing"
+	// RolloutPaused means the rollout is held by a pause step.
+	RolloutPaused RolloutPhase = "Paused"
+	// RolloutAborted means the rollout was aborted and the stable pod template serves all traffic again.
+	RolloutAborted RolloutPhase = "Aborted"
+)
+
+// RolloutStatus reports the progress of the rollout strategy.
+type RolloutStatus struct {
+	// Phase summarizes the progress of the rollout.
+	// +optional
+	Phase RolloutPhase `json:"phase,omitempty"`
+
+	// StableRevision is the hash of the pod template that is considered stable.
+	// +optional
+	StableRevision string `json:"stableRevision,omitempty"`
+
+	// CanaryRevision is the hash of the pod template being rolled out. It is empty when no rollout is in progress.
+	// +optional
+	CanaryRevision string `json:"canaryRevision,omitempty"`
+
+	// AbortedRevision is the hash of the pod template whose rollout was aborted. The same pod template
+	// is not rolled out again until spec.workflow.template changes.
+	// +optional
+	AbortedRevision string `json:"abortedRevision,omitempty"`
+
+	// ActiveColor is the color of the Deployment selected by the main Service when the blue/green strategy is used.
+	// +kubebuilder:validation:Enum=blue;green
+	// +optional
+	ActiveColor string `json:"activeColor,omitempty"`
+
+	// PreviewRevision is the hash of the pod template running behind the preview Service and waiting for promotion.
+	// +optional
+	PreviewRevision string `json:"previewRevision,omitempty"`
+
+	// ScaleDownTime is the time the previous color will be scaled down after a blue/green promotion.
+	// +optional
+	ScaleDownTime *metav1.Time `json:"scaleDownTime,omitempty"`
+
+	// CurrentStepIndex is the index of the canary step being executed.
+	// +optional
+	CurrentStepIndex int32 `json:"currentStepIndex,omitempty"`
+
+	// CurrentWeight is the percentage of replicas running the canary pod template.
+	// +optional
+	CurrentWeight int32 `json:"currentWeight,omitempty"`
+
+	// PauseStartTime is the time the current pause step started.
+	// +optional
+	PauseStartTime *metav1.Time `json:"pauseStartTime,omitempty"`
+
+	// Message is a human readable description of the rollout progress.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+// The route types mirror the subset of the Gateway API (gateway.networking.k8s.io/v1) HTTPRoute that
+// the operator renders. Their JSON field names match the Gateway API, so that the rendered spec can be
+// sent as is, without depending on the Gateway API module.
+
+// HTTPRouteSpec describes a Gateway API HTTPRoute generated for the Application.
+type HTTPRouteSpec struct {
+	// Name of the route. The generated HTTPRoute is named <application>-<name>.
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// ParentRefs are the Gateways (or Gateway listeners) the route attaches to.
+	// +kubebuilder:validation:MinItems=1
+	ParentRefs []RouteParentRef `json:"parentRefs"`
+
+	// Hostnames matched against the Host header of requests.
+	// +optional
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// Rules route the matching requests to the backends. Without rules, all requests are sent to the Service
+	// of the Application.
+	// +optional
+	Rules []HTTPRouteRule `json:"rules,omitempty"`
+}
+
+// RouteParentRef refers to the Gateway a route attaches to.
+type RouteParentRef struct {
+	// Group of the parent. Defaults to gateway.networking.k8s.io.
+	// +optional
+	Group *string `json:"group,omitempty"`
+
+	// Kind of the parent. Defaults to Gateway.
+	// +optional
+	Kind *string `json:"kind,omitempty"`
+
+	// Namespace of the parent. Defaults to the namespace of the Application.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+
+	// Name of the parent.
+	Name string `json:"name"`
+
+	// SectionName selects a listener of the Gateway.
+	// +optional
+	SectionName *string `json:"sectionName,omitempty"`
+
+	// Port selects the listeners of the Gateway by port.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// HTTPRouteRule routes the requests matching any of the matches to the backends.
+type HTTPRouteRule struct {
+	// Matches of the rule. A rule without matches matches all requests.
+	// +optional
+	Matches []HTTPRouteMatch `json:"matches,omitempty"`
+
+	// BackendRefs the matching requests are sent to, split by weight. Defaults to the Service of the Application.
+	// +optional
+	BackendRefs []HTTPBackendRef `json:"backendRefs,omitempty"`
+}
+
+// HTTPRouteMatch matches requests by path, headers and method. All of the set conditions must match.
+type HTTPRouteMatch struct {
+	// +optional
+	Path *HTTPPathMatch `json:"path,omitempty"`
+
+	// +optional
+	Headers []HTTPHeaderMatch `json:"headers,omitempty"`
+
+	// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;DELETE;CONNECT;OPTIONS;TRACE;PATCH
+	// +optional
+	Method *string `json:"method,omitempty"`
+}
+
+// HTTPPathMatch matches the path of requests.
+type HTTPPathMatch struct {
+	// Type of the match. Defaults to PathPrefix.
+	// +kubebuilder:validation:Enum=Exact;PathPrefix;RegularExpression
+	// +optional
+	Type *string `json:"type,omitempty"`
+
+	// Value of the path. Defaults to "/".
+	// +optional
+	Value *string `json:"value,omitempty"`
+}
+
+// HTTPHeaderMatch matches a header of requests.
+type HTTPHeaderMatch struct {
+	// Type of the match. Defaults to Exact.
+	// +kubebuilder:validation:Enum=Exact;RegularExpression
+	// +optional
+	Type *string `json:"type,omitempty"`
+
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HTTPBackendRef is a Service the requests are sent to.
+type HTTPBackendRef struct {
+	// Name of the Service. Defaults to the Service of the Application.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Port of the Service. Defaults to the first port of the Service of the Application.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// Weight of the backend relative to the other backends of the rule.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadKind is the kind of the workload generated for the Application.
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;Job;CronJob
+type WorkloadKind string
+
+const (
+	WorkloadDeployment  WorkloadKind = "Deployment"
+	WorkloadStatefulSet WorkloadKind = "StatefulSet"
+	WorkloadJob         WorkloadKind = "Job"
+	WorkloadCronJob     WorkloadKind = "CronJob"
+)
+
+// WorkloadSpec selects the kind of the generated workload. The pod template of spec.workflow is used for
+// all kinds. The replicas, selector, minReadySeconds and revisionHistoryLimit of spec.workflow are used for
+// Deployments and StatefulSets.
+type WorkloadSpec struct {
+	// Kind of the generated workload. The rollout strategies and autoscaling require a Deployment.
+	// Jobs and CronJobs only get a Service when spec.service.ports is set.
+	// +kubebuilder:default=Deployment
+	// +optional
+	Kind WorkloadKind `json:"kind,omitempty"`
+
+	// StatefulSet holds the fields that only exist on a StatefulSet. It is ignored for the other kinds.
+	// +optional
+	StatefulSet *StatefulSetTemplate `json:"statefulSet,omitempty"`
+
+	// Job describes the Job run for the Job kind, and the Jobs created by the CronJob for the CronJob kind.
+	// +optional
+	Job *JobTemplate `json:"job,omitempty"`
+
+	// CronJob holds the schedule of the CronJob kind. It is required for that kind.
+	// +optional
+	CronJob *CronJobTemplate `json:"cronJob,omitempty"`
+}
+
+// StatefulSetTemplate describes the StatefulSet specific fields of the generated StatefulSet.
+// The StatefulSet is governed by a headless Service named <application>-headless, or by the Service of the
+// Application when spec.service.clusterIP is None.
+type StatefulSetTemplate struct {
+	// VolumeClaimTemplates are the PersistentVolumeClaims created for every pod. They cannot be changed
+	// once the StatefulSet has been created.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +optional
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
+	// PodManagementPolicy controls how pods are created and deleted while scaling. It cannot be changed
+	// once the StatefulSet has been created.
+	// +kubebuilder:validation:Enum=OrderedReady;Parallel
+	// +optional
+	PodManagementPolicy appsv1.PodManagementPolicyType `json:"podManagementPolicy,omitempty"`
+
+	// UpdateStrategy of the StatefulSet.
+	// +optional
+	UpdateStrategy *appsv1.StatefulSetUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// PersistentVolumeClaimRetentionPolicy decides whether the PersistentVolumeClaims are deleted when the
+	// StatefulSet is deleted or scaled down.
+	// +optional
+	PersistentVolumeClaimRetentionPolicy *appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy `json:"persistentVolumeClaimRetentionPolicy,omitempty"`
+}
+
+// JobTemplate describes the Job specific fields of the generated Jobs. A change of the Job or of the pod
+// template replaces the Job of the Job kind, because the pod template of a Job is immutable.
+type JobTemplate struct {
+	// Parallelism is the maximum number of pods running at the same time.
+	// +optional
+	Parallelism *int32 `json:"parallelism,omitempty"`
+
+	// Completions is the number of pods that must succeed.
+	// +optional
+	Completions *int32 `json:"completions,omitempty"`
+
+	// BackoffLimit is the number of retries before the Job is marked as failed.
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds limits the duration of the Job.
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// TTLSecondsAfterFinished deletes the finished Jobs after the given time.
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// CronJobTemplate describes the schedule of the generated CronJob.
+type CronJobTemplate struct {
+	// Schedule in Cron format, e.g. "*/5 * * * *".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// TimeZone of the schedule, e.g. "Asia/Shanghai". Defaults to the time zone of the kube-controller-manager.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// ConcurrencyPolicy decides what happens when a run is scheduled while the previous one is still active.
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +optional
+	ConcurrencyPolicy batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// StartingDeadlineSeconds is the deadline for starting a run that missed its scheduled time.
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// SuccessfulJobsHistoryLimit is the number of succeeded Jobs kept.
+	// +optional
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+
+	// FailedJobsHistoryLimit is the number of failed Jobs kept.
+	// +optional
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+}
+
+// BatchStatus reports the runs of a Job or CronJob workload. The counts cover the Jobs that still exist,
+// finished Jobs are removed according to the history limits and ttlSecondsAfterFinished.
+type BatchStatus struct {
+	// Active lists the names of the running Jobs.
+	// +optional
+	Active []string `json:"active,omitempty"`
+
+	// LastScheduleTime is the time the last Job was started.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the time the last succeeded Job finished.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastFailureTime is the time the last failed Job failed.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// Succeeded is the number of succeeded Jobs.
+	// +optional
+	Succeeded int32 `json:"succeeded,omitempty"`
+
+	// Failed is the number of failed Jobs.
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+
+	// FinishedJob is the name of the last finished Job of the Job kind. It is not run again when it is removed
+	// after finishing, e.g. by ttlSecondsAfterFinished, until the Job or the pod template changes.
+	// +optional
+	FinishedJob string `json:"finishedJob,omitempty"`
+}
@@ -11,5 +11,34 @@ type DeploymentTemplate struct {
 }
 
 type ServiceTemplate struct {
+	// Annotations are added to the generated Service, e.g. to configure a cloud load balancer.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
 	corev1.ServiceSpec `json:",inline"`
 }
+
+// FieldConflict records a server-side apply conflict on a generated child resource.
+// Conflicts are reported instead of being silently overwritten unless spec.forceOwnership is set.
+type FieldConflict struct {
+	// Kind is the kind of the child resource, e.g. Deployment or Service.
+	Kind string `json:"kind"`
+	// Name is the name of the child resource.
+	Name string `json:"name"`
+	// Message is the conflict message returned by the API server, listing the conflicting fields and their managers.
+	Message string `json:"message"`
+}
+
+// DeletionPolicy decides what happens to the generated children when the Application is deleted.
+// +kubebuilder:validation:Enum=Delete;Orphan;Retain
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the children together with the Application.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan removes the owner references so the children keep running unmanaged.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// DeletionPolicyRetain behaves like Orphan and additionally marks the children with the
+	// apps.wuyong.cn/retained-from annotation, so they can be found and adopted by a new Application.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
@@ -0,0 +1,60 @@
+package shared
+
+// Well-known finalizers, labels and annotations used by the Application operator.
+const (
+	// CleanupFinalizer is added to every Application so the operator can apply spec.deletionPolicy
+	// to the generated children before the Application goes away.
+	CleanupFinalizer = "apps.wuyong.cn/cleanup"
+
+	// AnnotationRetainedFrom is set on children released with the Retain deletion policy.
+	// Its value is the namespace/name of the Application the child was retained from.
+	AnnotationRetainedFrom = "apps.wuyong.cn/retained-from"
+
+	// AnnotationAdopt set to "true" on an Application allows the operator to adopt pre-existing
+	// children with the same name that are not controlled by anything else.
+	AnnotationAdopt = "apps.wuyong.cn/adopt"
+
+	// LabelInstance and LabelApplicationUID are generated by the operator and used as the selector of the
+	// generated workloads and Services. They never change for the lifetime of an Application, so editing
+	// metadata.labels cannot break the immutable Deployment selector, and Applications sharing a label
+	// cannot select each other's pods.
+	LabelInstance       = "app.kubernetes.io/instance"
+	LabelApplicationUID = "apps.wuyong.cn/application-uid"
+
+	// LabelComponent is set on the children of a component of an Application to the name of the component.
+	// The pods of a component use <application>-<component> as LabelInstance, so the selectors of the
+	// Application and of its components never overlap.
+	LabelComponent = "apps.wuyong.cn/component"
+
+	// LabelTrack distinguishes the pods of the canary Deployment from the stable ones.
+	LabelTrack = "apps.wuyong.cn/track"
+	// LabelColor distinguishes the pods of the blue and green Deployments.
+	LabelColor = "apps.wuyong.cn/color"
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+	// LabelConfig marks the ConfigMaps generated from spec.config, its value tells whether a ConfigMap
+	// holds files or environment variables.
+	LabelConfig = "apps.wuyong.cn/config"
+	// AnnotationConfigChecksum records a checksum of the generated configuration and the referenced Secrets
+	// on the pod template, so that changing them rolls the pods out.
+	AnnotationConfigChecksum = "apps.wuyong.cn/config-checksum"
+	// AnnotationRevision records the hash of the pod template a generated workload was rendered from.
+	AnnotationRevision = "apps.wuyong.cn/revision"
+
+	// AnnotationRolloutAction requests a manual rollout action on an Application. The operator removes
+	// the annotation once the action has been handled. Supported values are RolloutActionPromote,
+	// RolloutActionResume and RolloutActionAbort.
+	AnnotationRolloutAction = "apps.wuyong.cn/rollout-action"
+	// RolloutActionPromote promotes the new pod template: it skips the remaining canary steps or
+	// switches the main Service to the blue/green preview color.
+	RolloutActionPromote = "promote"
+	// RolloutActionResume finishes the current pause step of a canary rollout.
+	RolloutActionResume = "resume"
+	// RolloutActionAbort stops the rollout and moves all traffic back to the stable pod template.
+	RolloutActionAbort = "abort"
+
+	// AnnotationRollbackTo requests a rollback of an Application to the ControllerRevision with the given
+	// revision number, or to the previous revision when the value is 0. The operator writes the recorded
+	// spec back to the Application and removes the annotation.
+	AnnotationRollbackTo = "apps.wuyong.cn/rollback-to"
+)
@@ -0,0 +1,73 @@
+package shared
+
+// Condition types reported in Application status.conditions.
+const (
+	// ConditionAvailable means the workload of the Application has the minimum number of available replicas.
+	ConditionAvailable = "Available"
+	// ConditionProgressing means the generated children are being created or rolled out.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded means the Application failed to reach or maintain its desired state.
+	ConditionDegraded = "Degraded"
+	// ConditionCleanup reports the progress of the cleanup finalizer while the Application is being deleted.
+	ConditionCleanup = "Cleanup"
+	// ConditionSuspended means the operator does not change the generated children because spec.suspend is set.
+	ConditionSuspended = "Suspended"
+	// ConditionRoutesReady reports whether the HTTPRoutes of spec.routes have been applied. It is only set
+	// when spec.routes is not empty.
+	ConditionRoutesReady = "RoutesReady"
+	// ConditionNetworkPolicyReady reports whether all peers of spec.network could be resolved. It is only set
+	// when spec.network is set.
+	ConditionNetworkPolicyReady = "NetworkPolicyReady"
+	// ConditionWaitingForDependencies is True while the workload is held back because some Applications of
+	// spec.dependsOn are not Available. It is only set when spec.dependsOn is not empty.
+	ConditionWaitingForDependencies = "WaitingForDependencies"
+)
+
+// Condition reasons reported in Application status.conditions.
+const (
+	ReasonReconcileError             = "ReconcileError"
+	ReasonFieldConflict              = "FieldConflict"
+	ReasonProgressDeadlineExceeded   = "ProgressDeadlineExceeded"
+	ReasonReplicaFailure             = "ReplicaFailure"
+	ReasonMinimumReplicasAvailable   = "MinimumReplicasAvailable"
+	ReasonMinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+	ReasonRolloutInProgress          = "RolloutInProgress"
+	ReasonRolloutComplete            = "RolloutComplete"
+	ReasonAsExpected                 = "AsExpected"
+	ReasonWaitingForChildren         = "WaitingForChildren"
+	ReasonChildrenReleased           = "ChildrenReleased"
+	ReasonAdoptionRefused            = "AdoptionRefused"
+	ReasonRollbackFailed             = "RollbackFailed"
+	ReasonSuspended                  = "Suspended"
+	ReasonRoutesApplied              = "RoutesApplied"
+	ReasonGatewayAPINotInstalled     = "GatewayAPINotInstalled"
+	ReasonPeersResolved              = "PeersResolved"
+	ReasonPeerNotFound               = "PeerNotFound"
+	ReasonJobActive                  = "JobActive"
+	ReasonJobFailed                  = "JobFailed"
+	ReasonJobsIdle                   = "JobsIdle"
+	ReasonComponentFailed            = "ComponentFailed"
+	ReasonDependenciesNotAvailable   = "DependenciesNotAvailable"
+	ReasonDependenciesAvailable      = "DependenciesAvailable"
+	ReasonPodFailure                 = "PodFailure"
+)
+
+// ApplicationPhase is a short summary of the Application conditions.
+// +kubebuilder:validation:Enum=Pending;Progressing;Running;Degraded;Suspended;Terminating
+type ApplicationPhase string
+
+const (
+	// PhasePending means the children have not reported any status yet, or the workload is held back until
+	// the Applications of spec.dependsOn are Available.
+	PhasePending ApplicationPhase = "Pending"
+	// PhaseProgressing means a rollout is in progress.
+	PhaseProgressing ApplicationPhase = "Progressing"
+	// PhaseRunning means the Application is available and fully rolled out.
+	PhaseRunning ApplicationPhase = "Running"
+	// PhaseDegraded means the Application failed to reach or maintain its desired state.
+	PhaseDegraded ApplicationPhase = "Degraded"
+	// PhaseSuspended means spec.suspend is set and the children are not changed by the operator.
+	PhaseSuspended ApplicationPhase = "Suspended"
+	// PhaseTerminating means the Application is being deleted and its children are being cleaned up.
+	PhaseTerminating ApplicationPhase = "Terminating"
+)
@@ -25,10 +25,15 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -37,6 +42,7 @@ import (
 
 	appsv1 "github.com/wuyong7240/application-operator-plus/api/apps/v1"
 	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
 	controller "github.com/wuyong7240/application-operator-plus/internal/controller/apps"
 	webhookv1 "github.com/wuyong7240/application-operator-plus/internal/webhook/apps/v1"
 	webhookappsv2 "github.com/wuyong7240/application-operator-plus/internal/webhook/apps/v2"
@@ -158,6 +164,13 @@ func main() {
 		metricsServerOptions.KeyName = metricsCertKey
 	}
 
+	// 控制器只关心Application生成的Pod，缓存中只保留带有Application UID标签的Pod，避免缓存集群中所有的Pod
+	podSelector, err := labels.NewRequirement(shared.LabelApplicationUID, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to build the pod cache selector")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
@@ -165,6 +178,11 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "1b96da23.wuyong.cn",
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Pod{}: {Label: labels.NewSelector().Add(*podSelector)},
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -182,9 +200,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 检测集群中是否安装了Gateway API，没有安装时spec.routes不会生效，Application上会有RoutesReady condition说明原因
+	gatewayAPIAvailable, err := controller.GatewayAPIInstalled(mgr.GetRESTMapper())
+	if err != nil {
+		setupLog.Error(err, "unable to detect the Gateway API")
+		os.Exit(1)
+	}
+	if !gatewayAPIAvailable {
+		setupLog.Info("the Gateway API CRDs are not installed, spec.routes of Applications will not be rendered")
+	}
+
 	if err := (&controller.ApplicationReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		GatewayAPIAvailable: gatewayAPIAvailable,
+		// ConfigMap和Secret只以元数据的形式缓存，它们的内容通过APIReader直接读取，
+		// 避免缓存集群中所有Secret的内容，代价是每次调谐对每个引用的对象发送一次GET
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Application")
 		os.Exit(1)
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// AdoptionRefusedError 表示同名的子资源已经存在，但是不能被Application接管。
+// 这种错误需要用户介入才能解决，控制器会在Degraded condition中报告原因，而不是不断重试
+type AdoptionRefusedError struct {
+	Child  string
+	Reason string
+}
+
+func (e *AdoptionRefusedError) Error() string {
+	return fmt.Sprintf("refusing to adopt %s: %s", e.Child, e.Reason)
+}
+
+// adoptionEnabled 判断Application是否允许接管已经存在的同名子资源
+func adoptionEnabled(app *v2.Application) bool {
+	return app.Annotations[shared.AnnotationAdopt] == "true"
+}
+
+// checkOwnership 在提交子资源之前检查集群中同名资源的归属：
+//   - 不存在或者已经由当前Application控制时，直接放行
+//   - 由其他控制器控制时，拒绝接管
+//   - 没有控制器时，只有Application开启了接管（或者子资源是以Retain策略从同名Application保留下来的），
+//     并且compatible校验通过，才允许接管，随后的Server-Side Apply会为它设置controller reference
+func (r *ApplicationReconciler) checkOwnership(ctx context.Context, app *v2.Application, desired client.Object,
+	compatible func(live client.Object) error) error {
+	log := log.FromContext(ctx)
+
+	live := desired.DeepCopyObject().(client.Object)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if metav1.IsControlledBy(live, app) {
+		return nil
+	}
+
+	gvk, err := apiutil.GVKForObject(desired, r.Scheme)
+	if err != nil {
+		return err
+	}
+	child := gvk.Kind + "/" + live.GetName()
+
+	if ref := metav1.GetControllerOf(live); ref != nil {
+		return &AdoptionRefusedError{Child: child, Reason: fmt.Sprintf("it is controlled by %s/%s", ref.Kind, ref.Name)}
+	}
+	retained := live.GetAnnotations()[shared.AnnotationRetainedFrom] == app.Namespace+"/"+app.Name
+	if !adoptionEnabled(app) && !retained {
+		return &AdoptionRefusedError{
+			Child:  child,
+			Reason: fmt.Sprintf("it already exists and is not managed by this Application, set the %s=true annotation to adopt it", shared.AnnotationAdopt),
+		}
+	}
+	if compatible != nil {
+		if err := compatible(live); err != nil {
+			return &AdoptionRefusedError{Child: child, Reason: err.Error()}
+		}
+	}
+
+	log.Info("Adopting the existing child resource.", "child", child)
+	return nil
+}
@@ -18,29 +18,52 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
 	"reflect"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	v1 "github.com/wuyong7240/application-operator-plus/api/apps/v1"
 	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 // ApplicationReconciler reconciles a Application object
 type ApplicationReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// GatewayAPIAvailable表示集群中是否安装了Gateway API的CRD，由main在启动时检测，为false时不会生成HTTPRoute
+	GatewayAPIAvailable bool
+	// APIReader直接读取API Server，用于读取Application引用的ConfigMap和Secret的内容，
+	// 缓存中只有它们的元数据。为空时使用Client
+	APIReader client.Reader
+}
+
+// apiReader 返回读取ConfigMap和Secret内容使用的client.Reader
+func (r *ApplicationReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
 }
 
 // +kubebuilder:rbac:groups=apps.wuyong.cn,resources=applications,verbs=get;list;watch;create;update;patch;delete
@@ -49,8 +72,27 @@ type ApplicationReconciler struct {
 
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs/status;cronjobs/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
+// 绑定spec.identity.roles需要bind权限：Role只在Application所在的命名空间生效，ClusterRole只允许绑定内置的view和edit，
+// 需要绑定其他ClusterRole时由集群管理员单独授权。请求者自己是否有权限绑定这些角色由validating webhook检查
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=bind
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=bind,resourceNames=view;edit
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -91,48 +133,245 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	// reconcile sub-resource, 调谐子资源
-	var result ctrl.Result
-	var err error
+	// Application正在被删除时，按照spec.deletionPolicy清理子资源
+	if !app.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, app)
+	}
+
+	// 确保Application带有清理用的finalizer，这样删除时才有机会执行deletionPolicy
+	if controllerutil.AddFinalizer(app, shared.CleanupFinalizer) {
+		if err := r.Update(ctx, app); err != nil {
+			log.Error(err, "Failed to add finalizer, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The cleanup finalizer has been added.")
+	}
+
+	// 记录调谐前的状态，只有状态发生变化时才需要更新
+	original := app.Status.DeepCopy()
+
+	// reconcile sub-resource, 调谐子资源；Application被暂停时只同步子资源的状态
+	var requeue ctrl.Result
+	var reconcileErr error
+	if app.Spec.Suspend {
+		reconcileErr = r.observeChildren(ctx, app)
+	} else {
+		requeue, reconcileErr = r.reconcileChildren(ctx, app)
+	}
+
+	// 汇总Pod的失败原因和scale子资源的副本数，Application被暂停或者子资源调谐失败时同样需要报告
+	result, err := r.observePods(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to observe the pods.")
+		if reconcileErr == nil {
+			requeue, reconcileErr = result, err
+		}
+	} else {
+		requeue = mergeResult(requeue, result)
+	}
+
+	// 无论子资源是否调谐成功，都根据子资源的状态和调谐错误计算conditions，并更新Application的状态
+	if err := r.updateStatus(ctx, app, original, reconcileErr); err != nil {
+		log.Error(err, "Failed to update Application status, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	// 拒绝接管子资源和无法执行的回滚请求都需要用户介入，已经在Degraded condition中报告，不需要按照错误进行退避重试
+	var refused *AdoptionRefusedError
+	var rollbackFailed *RollbackFailedError
+	if stderrors.As(reconcileErr, &refused) || stderrors.As(reconcileErr, &rollbackFailed) {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, nil
+	}
+	if reconcileErr != nil {
+		return requeue, reconcileErr
+	}
+
+	log.Info("All resources have been reconciled.")
+	return requeue, nil
+}
+
+// reconcileChildren 依次调谐Application的子资源，遇到错误立即返回
+func (r *ApplicationReconciler) reconcileChildren(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 记录各个子资源要求的重新排队时间，取其中最短的一个
+	var requeue ctrl.Result
+
+	// 先处理回滚请求，回滚会修改spec，随后的子资源按照回滚后的spec渲染。
+	// 无法执行的回滚请求不影响子资源的调谐，在最后报告
+	rollbackErr := r.rollback(ctx, app)
+	var failed *RollbackFailedError
+	if rollbackErr != nil && !stderrors.As(rollbackErr, &failed) {
+		log.Error(rollbackErr, "Failed to roll back the Application.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, rollbackErr
+	}
 
-	result, err = r.reconcileDeployment(ctx, app)
+	// ServiceAccount需要先于Pod创建，否则Pod会因为找不到ServiceAccount而无法创建
+	result, err := r.reconcileIdentity(ctx, app)
 	if err != nil {
-		log.Error(err, "Failed to reconcile Deployment.")
+		log.Error(err, "Failed to reconcile the identity.")
 		return result, err
 	}
+	requeue = mergeResult(requeue, result)
+
+	// spec.dependsOn中的Application尚未全部可用时，暂不创建或者更新工作负载和组件，只同步它们当前的状态
+	blockers, err := r.waitForDependencies(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to check the dependencies, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if len(blockers) > 0 {
+		log.Info("Waiting for the dependencies to become Available.", "dependencies", blockers)
+		if err := r.observeWorkload(ctx, app); err != nil {
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if err := r.observeComponents(ctx, app); err != nil {
+			log.Error(err, "Failed to observe the components.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	} else {
+		result, err = r.reconcileWorkload(ctx, app)
+		if err != nil {
+			log.Error(err, "Failed to reconcile the workload.")
+			return result, err
+		}
+		requeue = mergeResult(requeue, result)
+	}
 
 	result, err = r.reconcileService(ctx, app)
 	if err != nil {
 		log.Error(err, "Failed to reconcle Service.")
 		return result, err
 	}
+	requeue = mergeResult(requeue, result)
 
-	log.Info("All resources have been reconciled.")
-	return ctrl.Result{}, nil
+	if len(blockers) == 0 {
+		result, err = r.reconcileComponents(ctx, app)
+		if err != nil {
+			log.Error(err, "Failed to reconcile the components.")
+			return result, err
+		}
+		requeue = mergeResult(requeue, result)
+	}
+
+	result, err = r.reconcileIngress(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile Ingress.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	result, err = r.reconcileRoutes(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile HTTPRoutes.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	result, err = r.reconcileNetworkPolicy(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile NetworkPolicy.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	result, err = r.reconcileHPA(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile HorizontalPodAutoscaler.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	result, err = r.reconcilePDB(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile PodDisruptionBudget.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	// 子资源调谐成功后，把本次渲染的spec记录为revision
+	result, err = r.reconcileHistory(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile the revision history.")
+		return result, err
+	}
+	requeue = mergeResult(requeue, result)
+
+	return requeue, rollbackErr
+}
+
+// mergeResult 合并两个调谐结果，返回更早需要重新排队的那个
+func mergeResult(a, b ctrl.Result) ctrl.Result {
+	if a.RequeueAfter == 0 {
+		return b
+	}
+	if b.RequeueAfter == 0 || a.RequeueAfter < b.RequeueAfter {
+		return a
+	}
+	return b
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	setupLog := ctrl.Log.WithName("Setup")
 
-	return ctrl.NewControllerManagedBy(mgr).
+	// 按照引用的ConfigMap和Secret索引Application，ConfigMap或者Secret变化时据此找到需要重新调谐的Application
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v2.Application{}, configReferenceIndex, configReferenceKeys); err != nil {
+		return err
+	}
+
+	// 按照spec.network引用的Application索引，被引用的Application创建或者删除时重新解析它的选择器标签
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v2.Application{}, networkPeerIndex, networkPeerKeys); err != nil {
+		return err
+	}
+
+	// 按照spec.dependsOn引用的Application索引，被依赖的Application可用性变化时重新检查依赖
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v2.Application{}, dependencyIndex, dependencyKeys); err != nil {
+		return err
+	}
+
+	// 按照UID索引Application，Pod的失败原因变化时据此找到它所属的Application
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v2.Application{}, applicationUIDIndex, applicationUIDKeys); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr)
+	// 只有集群中安装了Gateway API时才监听HTTPRoute，否则控制器会因为找不到资源类型而无法启动
+	if r.GatewayAPIAvailable {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(HTTPRouteGVK)
+		b = b.Owns(route, builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+
+	return b.
 		// 监听Application资源，通过predicate.Funcs自定义哪些事件会触发Reconcile
 		For(&v1.Application{}, builder.WithPredicates(predicate.Funcs{
 			// 一旦创建Application，立即触发Reconcile
 			CreateFunc: func(event event.CreateEvent) bool {
 				return true
 			},
-			// Application被删除，但是不触发Reconcile，仅打印日志，不会执行任何清理逻辑
+			// Application已经被真正删除（finalizer已经移除），清理逻辑在设置deletionTimestamp时已经执行，仅打印日志
 			DeleteFunc: func(event event.DeleteEvent) bool {
 				setupLog.Info("The Application has been deleted.", "Name", event.Object.GetName())
 				return false
 			},
-			// 只有当ResourceVersion不同，且Spec发生变化时，才触发Reconcile
+			// 只有当ResourceVersion不同，且Spec、注解发生变化、Application开始被删除或者取消暂停时，才触发Reconcile
 			UpdateFunc: func(event event.UpdateEvent) bool {
 				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
 					return false
 				}
-				if reflect.DeepEqual(event.ObjectNew.(*v1.Application).Spec, event.ObjectOld.(*v1.Application).Spec) {
+				if !event.ObjectNew.GetDeletionTimestamp().IsZero() {
+					return true
+				}
+				// 注解会影响控制器的行为（例如apps.wuyong.cn/adopt），变化时也需要触发
+				if !reflect.DeepEqual(event.ObjectNew.GetAnnotations(), event.ObjectOld.GetAnnotations()) {
+					return true
+				}
+				newApp, oldApp := event.ObjectNew.(*v1.Application), event.ObjectOld.(*v1.Application)
+				// 取消暂停时立即触发，让暂停期间积累的变化尽快生效
+				if oldApp.Spec.Suspend && !newApp.Spec.Suspend {
+					return true
+				}
+				if reflect.DeepEqual(newApp.Spec, oldApp.Spec) {
 					return false
 				}
 				return true
@@ -149,18 +388,72 @@ func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				setupLog.Info("The Deployment has been deleted.", "Name", event.Object.GetName())
 				return true
 			},
-			// 只有Spec变化时才触发，防止状态同步风暴，如果Deployment.Spec被外部修改，控制器会将其纠正回期望状态
+			// Spec变化时触发，如果Deployment.Spec被外部修改，控制器会将其纠正回期望状态；
+			// Status变化时也需要触发，以便Application的conditions能够跟随滚动更新的进度
 			UpdateFunc: func(event event.UpdateEvent) bool {
 				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
 					return false
 				}
-				if reflect.DeepEqual(event.ObjectNew.(*appsv1.Deployment).Spec, event.ObjectOld.(*appsv1.Deployment).Spec) {
+				newDp, oldDp := event.ObjectNew.(*appsv1.Deployment), event.ObjectOld.(*appsv1.Deployment)
+				// 手工添加或者修改的标签同样需要还原
+				if reflect.DeepEqual(newDp.Spec, oldDp.Spec) && reflect.DeepEqual(newDp.Status, oldDp.Status) &&
+					reflect.DeepEqual(newDp.Labels, oldDp.Labels) {
 					return false
 				}
 				return true
 			},
 			GenericFunc: nil,
 		})).
+		// 监听StatefulSet资源，与Deployment资源类似
+		Owns(&appsv1.StatefulSet{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The StatefulSet has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
+					return false
+				}
+				newSts, oldSts := event.ObjectNew.(*appsv1.StatefulSet), event.ObjectOld.(*appsv1.StatefulSet)
+				return !reflect.DeepEqual(newSts.Spec, oldSts.Spec) || !reflect.DeepEqual(newSts.Status, oldSts.Status)
+			},
+		})).
+		// 监听Job和CronJob资源，与Deployment资源类似，Status变化时更新Application中记录的运行情况
+		Owns(&batchv1.Job{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The Job has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
+					return false
+				}
+				newJob, oldJob := event.ObjectNew.(*batchv1.Job), event.ObjectOld.(*batchv1.Job)
+				return !reflect.DeepEqual(newJob.Spec, oldJob.Spec) || !reflect.DeepEqual(newJob.Status, oldJob.Status)
+			},
+		})).
+		Owns(&batchv1.CronJob{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The CronJob has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
+					return false
+				}
+				newCronJob, oldCronJob := event.ObjectNew.(*batchv1.CronJob), event.ObjectOld.(*batchv1.CronJob)
+				return !reflect.DeepEqual(newCronJob.Spec, oldCronJob.Spec) || !reflect.DeepEqual(newCronJob.Status, oldCronJob.Status)
+			},
+		})).
 		// 监听Service资源,与Deployment资源类似
 		Owns(&corev1.Service{}, builder.WithPredicates(predicate.Funcs{
 			CreateFunc: func(event event.CreateEvent) bool {
@@ -170,16 +463,176 @@ func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				setupLog.Info("The Service has been deleted.", "Name", event.Object.GetName())
 				return true
 			},
+			// Service的Spec或注解被修改时触发，控制器会将其纠正回期望状态
 			UpdateFunc: func(event event.UpdateEvent) bool {
 				if event.ObjectNew.GetResourceVersion() == event.ObjectOld.GetResourceVersion() {
 					return false
 				}
-				if reflect.DeepEqual(event.ObjectNew.(*v1.Application).Spec, event.ObjectOld.(*v1.Application).Spec) {
+				newSvc, ok := event.ObjectNew.(*corev1.Service)
+				if !ok {
+					return false
+				}
+				oldSvc, ok := event.ObjectOld.(*corev1.Service)
+				if !ok {
+					return false
+				}
+				if reflect.DeepEqual(newSvc.Spec, oldSvc.Spec) &&
+					reflect.DeepEqual(newSvc.Annotations, oldSvc.Annotations) {
+					return false
+				}
+				return true
+			},
+		})).
+		// 监听Ingress资源，与Service资源类似
+		Owns(&networkingv1.Ingress{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The Ingress has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				newIng, ok := event.ObjectNew.(*networkingv1.Ingress)
+				if !ok {
+					return false
+				}
+				oldIng, ok := event.ObjectOld.(*networkingv1.Ingress)
+				if !ok {
+					return false
+				}
+				return !reflect.DeepEqual(newIng.Spec, oldIng.Spec) || !reflect.DeepEqual(newIng.Annotations, oldIng.Annotations)
+			},
+		})).
+		// 监听HPA资源，只关心Spec的变化，HPA的状态会随着指标频繁变化
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The HorizontalPodAutoscaler has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				newHPA, ok := event.ObjectNew.(*autoscalingv2.HorizontalPodAutoscaler)
+				if !ok {
+					return false
+				}
+				oldHPA, ok := event.ObjectOld.(*autoscalingv2.HorizontalPodAutoscaler)
+				if !ok {
 					return false
 				}
+				return !reflect.DeepEqual(newHPA.Spec, oldHPA.Spec)
+			},
+		})).
+		// 监听PDB资源，与HPA资源类似
+		Owns(&policyv1.PodDisruptionBudget{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The PodDisruptionBudget has been deleted.", "Name", event.Object.GetName())
 				return true
 			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				newPDB, ok := event.ObjectNew.(*policyv1.PodDisruptionBudget)
+				if !ok {
+					return false
+				}
+				oldPDB, ok := event.ObjectOld.(*policyv1.PodDisruptionBudget)
+				if !ok {
+					return false
+				}
+				return !reflect.DeepEqual(newPDB.Spec, oldPDB.Spec)
+			},
+		})).
+		// 监听生成的ConfigMap，它们是不可变的，只需要在被删除时重新生成。
+		// ConfigMap和Secret只监听元数据，缓存中不保存集群中所有ConfigMap和Secret的内容
+		Owns(&corev1.ConfigMap{}, builder.OnlyMetadata, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The ConfigMap has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				return false
+			},
+		})).
+		// 监听NetworkPolicy资源，与PDB资源类似
+		Owns(&networkingv1.NetworkPolicy{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The NetworkPolicy has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				newNP, ok := event.ObjectNew.(*networkingv1.NetworkPolicy)
+				if !ok {
+					return false
+				}
+				oldNP, ok := event.ObjectOld.(*networkingv1.NetworkPolicy)
+				if !ok {
+					return false
+				}
+				return !reflect.DeepEqual(newNP.Spec, oldNP.Spec)
+			},
+		})).
+		// 监听被spec.network引用的Application：它们的选择器标签包含UID，创建或者删除后需要重新渲染NetworkPolicy
+		Watches(&v2.Application{}, handler.EnqueueRequestsFromMapFunc(r.applicationsAllowing),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(event event.UpdateEvent) bool {
+					return false
+				},
+			})).
+		// 监听被spec.dependsOn引用的Application，它们变为可用或者不可用时重新检查依赖
+		Watches(&v2.Application{}, handler.EnqueueRequestsFromMapFunc(r.applicationsDependingOn),
+			builder.WithPredicates(availabilityChangedPredicate())).
+		// 监听ServiceAccount和RoleBinding，被删除时重新创建
+		Owns(&corev1.ServiceAccount{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The ServiceAccount has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				return false
+			},
+		})).
+		Owns(&rbacv1.RoleBinding{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event event.CreateEvent) bool {
+				return false
+			},
+			DeleteFunc: func(event event.DeleteEvent) bool {
+				setupLog.Info("The RoleBinding has been deleted.", "Name", event.Object.GetName())
+				return true
+			},
+			UpdateFunc: func(event event.UpdateEvent) bool {
+				newBinding, ok := event.ObjectNew.(*rbacv1.RoleBinding)
+				if !ok {
+					return false
+				}
+				oldBinding, ok := event.ObjectOld.(*rbacv1.RoleBinding)
+				if !ok {
+					return false
+				}
+				return !reflect.DeepEqual(newBinding.Subjects, oldBinding.Subjects)
+			},
 		})).
+		// 监听Application引用的ConfigMap和Secret，它们变化时触发引用它们的Application，
+		// 只监听元数据，内容由reconcileConfig按需读取，没有变化时校验和不变，不会滚动Pod
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.applicationsReferencing("ConfigMap")),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.applicationsReferencing("Secret")),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		// 监听Application的Pod，它们的失败原因变化时更新status.podFailures
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.applicationForPod),
+			builder.WithPredicates(podFailuresChangedPredicate())).
 		// 给控制器起名，日志和metrics中显示为controller "application"
 		Named("application").
 		// 完成注册，将Reconciler绑定到控制器上，并启动事件监听
@@ -18,16 +18,33 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	k8sappsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	appsv1 "github.com/wuyong7240/application-operator-plus/api/apps/v1"
+	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
 )
 
 var _ = Describe("Application Controller", func() {
@@ -81,4 +98,1558 @@ var _ = Describe("Application Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When the Application spec changes", func() {
+		const resourceName = "test-update"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			replicas := int32(1)
+			resource := &appsv2.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+					Labels:    map[string]string{"app": resourceName},
+				},
+				Spec: appsv2.ApplicationSpec{
+					Workflow: shared.DeploymentTemplate{DeploymentSpec: k8sappsv1.DeploymentSpec{
+						Replicas: &replicas,
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": resourceName}},
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+						},
+					}},
+					Service: shared.ServiceTemplate{ServiceSpec: corev1.ServiceSpec{
+						Ports: []corev1.ServicePort{{Port: 80}},
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &appsv2.Application{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if errors.IsNotFound(err) {
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Reconciling until the cleanup finalizer has been removed")
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			Eventually(func() bool {
+				_, _ = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				return errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv2.Application{}))
+			}).Should(BeTrue())
+		})
+
+		It("should propagate workflow changes to the existing Deployment", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Reconciling the created resource")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Changing the image and replicas of the Application")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			replicas := int32(2)
+			app.Spec.Workflow.Replicas = &replicas
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that the Deployment has been updated")
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(int32(2)))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+		})
+
+		It("should remove environment variables that were removed from the Application", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workflow.Template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "MODE", Value: "debug"}, {Name: "LEVEL", Value: "info"}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Removing one of the environment variables")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workflow.Template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "LEVEL", Value: "info"}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Env).To(Equal([]corev1.EnvVar{{Name: "LEVEL", Value: "info"}}))
+		})
+
+		It("should revert manual edits of the Deployment", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Adding a label and changing the image like kubectl label and kubectl edit")
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			patch := client.MergeFrom(dp.DeepCopy())
+			dp.Labels["manual"] = "true"
+			Expect(k8sClient.Patch(ctx, dp, patch, client.FieldOwner("kubectl-label"))).To(Succeed())
+			patch = client.MergeFrom(dp.DeepCopy())
+			dp.Spec.Template.Spec.Containers[0].Image = "nginx:manual"
+			Expect(k8sClient.Patch(ctx, dp, patch, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Labels).NotTo(HaveKey("manual"))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+		})
+
+		It("should keep the allocated addresses and ports when spec.service changes", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// updateService 修改Application的spec.service并重新调谐，返回更新后的Service
+			updateService := func(mutate func(template *shared.ServiceTemplate)) *corev1.Service {
+				app := &appsv2.Application{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+				mutate(&app.Spec.Service)
+				Expect(k8sClient.Update(ctx, app)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				svc := &corev1.Service{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+				return svc
+			}
+
+			By("Switching the Service to NodePort")
+			svc := updateService(func(template *shared.ServiceTemplate) {
+				template.Type = corev1.ServiceTypeNodePort
+			})
+			Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+			Expect(svc.Spec.ClusterIP).NotTo(BeEmpty())
+			Expect(svc.Spec.Ports[0].NodePort).NotTo(BeZero())
+			clusterIP, clusterIPs, nodePort := svc.Spec.ClusterIP, svc.Spec.ClusterIPs, svc.Spec.Ports[0].NodePort
+
+			By("Changing the target port and the annotations of the NodePort Service")
+			svc = updateService(func(template *shared.ServiceTemplate) {
+				template.Annotations = map[string]string{"team": "web"}
+				template.Ports[0].TargetPort = intstr.FromInt32(8080)
+			})
+			Expect(svc.Annotations).To(HaveKeyWithValue("team", "web"))
+			Expect(svc.Spec.Ports[0].TargetPort).To(Equal(intstr.FromInt32(8080)))
+			Expect(svc.Spec.ClusterIP).To(Equal(clusterIP))
+			Expect(svc.Spec.ClusterIPs).To(Equal(clusterIPs))
+			Expect(svc.Spec.Ports[0].NodePort).To(Equal(nodePort))
+
+			By("Switching the Service to LoadBalancer with the Local external traffic policy")
+			svc = updateService(func(template *shared.ServiceTemplate) {
+				template.Type = corev1.ServiceTypeLoadBalancer
+				template.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+			})
+			Expect(svc.Spec.HealthCheckNodePort).NotTo(BeZero())
+			Expect(svc.Spec.ClusterIP).To(Equal(clusterIP))
+			Expect(svc.Spec.Ports[0].NodePort).To(Equal(nodePort))
+			healthCheckNodePort := svc.Spec.HealthCheckNodePort
+
+			By("Changing the annotations of the LoadBalancer Service")
+			svc = updateService(func(template *shared.ServiceTemplate) {
+				template.Annotations = map[string]string{"team": "platform"}
+			})
+			Expect(svc.Annotations).To(HaveKeyWithValue("team", "platform"))
+			Expect(svc.Spec.ClusterIP).To(Equal(clusterIP))
+			Expect(svc.Spec.ClusterIPs).To(Equal(clusterIPs))
+			Expect(svc.Spec.Ports[0].NodePort).To(Equal(nodePort))
+			Expect(svc.Spec.HealthCheckNodePort).To(Equal(healthCheckNodePort))
+		})
+
+		It("should revert manual edits of the Service", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Service.Annotations = map[string]string{"team": "web"}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Changing the ports, the type and the annotations like kubectl edit")
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			patch := client.MergeFrom(svc.DeepCopy())
+			svc.Annotations["team"] = "manual"
+			svc.Annotations["manual"] = "true"
+			svc.Spec.Type = corev1.ServiceTypeNodePort
+			svc.Spec.Ports[0].Port = 8080
+			Expect(k8sClient.Patch(ctx, svc, patch, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			Expect(svc.Annotations).To(HaveKeyWithValue("team", "web"))
+			Expect(svc.Annotations).NotTo(HaveKey("manual"))
+			Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+			Expect(svc.Spec.Ports).To(HaveLen(1))
+			Expect(svc.Spec.Ports[0].Port).To(Equal(int32(80)))
+			Expect(svc.Spec.Ports[0].NodePort).To(BeZero())
+		})
+
+		It("should take over the fields written before server-side apply was used", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Creating the Deployment with an Update manager like earlier versions of the operator")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			legacy := &k8sappsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default", Labels: childLabels(app)},
+				Spec:       *app.Spec.Workflow.DeploymentSpec.DeepCopy(),
+			}
+			legacy.Spec.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels(app)}
+			legacy.Spec.Template.Labels = selectorLabels(app)
+			Expect(controllerutil.SetControllerReference(app, legacy, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacy, client.FieldOwner("manager"))).To(Succeed())
+
+			By("Changing the image of the Application")
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+			for _, entry := range dp.ManagedFields {
+				Expect(entry.Manager).NotTo(Equal("manager"))
+			}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Conflicts).To(BeEmpty())
+		})
+
+		It("should keep the children running with the Orphan deletion policy", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Deleting the Application with the Orphan deletion policy")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Finalizers).To(ContainElement(shared.CleanupFinalizer))
+			app.Spec.DeletionPolicy = shared.DeletionPolicyOrphan
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, app)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv2.Application{}))).To(BeTrue())
+
+			By("Checking that the Deployment is kept without owner references")
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.OwnerReferences).To(BeEmpty())
+			Expect(k8sClient.Delete(ctx, dp)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Name: resourceName, Namespace: "default",
+			}})).To(Succeed())
+		})
+
+		It("should take the children over after the Application is recreated with the Retain deletion policy", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Deleting the Application with the Retain deletion policy")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			previous := selectorLabels(app)
+			app.Spec.DeletionPolicy = shared.DeletionPolicyRetain
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv2.Application{}))).To(BeTrue())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.OwnerReferences).To(BeEmpty())
+			Expect(dp.Annotations).To(HaveKeyWithValue(shared.AnnotationRetainedFrom, "default/"+resourceName))
+
+			By("Creating a pod of the retained Deployment like its ReplicaSet would")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-update-retained", Namespace: "default", Labels: dp.Spec.Template.Labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed()) })
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			By("Recreating the Application with the same name")
+			recreated := &appsv2.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec:       *app.Spec.DeepCopy(),
+			}
+			recreated.Spec.DeletionPolicy = ""
+			Expect(k8sClient.Create(ctx, recreated)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, recreated)).To(Succeed())
+			Expect(recreated.UID).NotTo(Equal(app.UID))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(metav1.IsControlledBy(dp, recreated)).To(BeTrue())
+			// selector是不可变的，仍然带有之前的Application的UID
+			Expect(dp.Spec.Selector.MatchLabels).To(Equal(previous))
+
+			By("Checking that the Service and the status still select the pods of the Deployment")
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			Expect(metav1.IsControlledBy(svc, recreated)).To(BeTrue())
+			Expect(labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels))).To(BeTrue())
+			selector, err := labels.Parse(recreated.Status.Selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector.Matches(labels.Set(pod.Labels))).To(BeTrue())
+			Expect(recreated.Status.Replicas).To(Equal(int32(1)))
+		})
+
+		It("should adopt an existing Deployment only when adoption is enabled", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Creating a Deployment that is not managed by the Application")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			existing := &k8sappsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec:       *app.Spec.Workflow.DeploymentSpec.DeepCopy(),
+			}
+			existing.Spec.Template.Labels = map[string]string{"app": resourceName}
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			degraded := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionDegraded)
+			Expect(degraded).NotTo(BeNil())
+			Expect(degraded.Reason).To(Equal(shared.ReasonAdoptionRefused))
+
+			By("Enabling adoption on the Application")
+			app.Annotations = map[string]string{shared.AnnotationAdopt: "true"}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(metav1.IsControlledBy(dp, app)).To(BeTrue())
+		})
+
+		It("should select the pods of an adopted Deployment whose selector has a foreign UID", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Creating a Deployment left behind by a previous Application with the same name")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			foreign := map[string]string{shared.LabelInstance: resourceName, shared.LabelApplicationUID: "previous-uid"}
+			existing := &k8sappsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec:       *app.Spec.Workflow.DeploymentSpec.DeepCopy(),
+			}
+			existing.Spec.Selector = &metav1.LabelSelector{MatchLabels: foreign}
+			existing.Spec.Template.Labels = foreign
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+
+			By("Adopting it")
+			app.Annotations = map[string]string{shared.AnnotationAdopt: "true"}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(metav1.IsControlledBy(dp, app)).To(BeTrue())
+			Expect(dp.Spec.Selector.MatchLabels).To(Equal(foreign))
+
+			By("Creating a pod from the template of the Deployment like its ReplicaSet would")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-update-adopted", Namespace: "default", Labels: dp.Spec.Template.Labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed()) })
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			Expect(labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			selector, err := labels.Parse(app.Status.Selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector.Matches(labels.Set(pod.Labels))).To(BeTrue())
+			Expect(app.Status.Replicas).To(Equal(int32(1)))
+		})
+
+		It("should report conditions, observedGeneration and phase", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// envtest中没有运行Deployment控制器，因此Deployment永远不会变为可用
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.ObservedGeneration).To(Equal(app.Generation))
+			Expect(app.Status.Phase).To(Equal(shared.PhaseProgressing))
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(app.Status.Conditions, shared.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionDegraded)).To(BeTrue())
+		})
+
+		It("should record revisions and roll back to a previous one", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Changing the image of the Application")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			firstRevision := app.Status.CurrentRevision
+			Expect(firstRevision).NotTo(BeEmpty())
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			revisions := &k8sappsv1.ControllerRevisionList{}
+			// envtest中没有运行垃圾回收器，其他用例留下的revision需要通过标签过滤掉
+			Expect(k8sClient.List(ctx, revisions, client.InNamespace("default"),
+				client.MatchingLabels(selectorLabels(app)))).To(Succeed())
+			Expect(revisions.Items).To(HaveLen(2))
+
+			By("Rolling back to the first revision")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Annotations = map[string]string{shared.AnnotationRollbackTo: "1"}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Annotations).NotTo(HaveKey(shared.AnnotationRollbackTo))
+			Expect(app.Spec.Workflow.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+			Expect(app.Status.CurrentRevision).To(Equal(firstRevision))
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+
+			current := &k8sappsv1.ControllerRevision{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: firstRevision, Namespace: "default"}, current)).To(Succeed())
+			Expect(current.Revision).To(Equal(int64(3)))
+		})
+
+		It("should leave the children unchanged while the Application is suspended", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Suspending the Application and changing its image")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Suspend = true
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(app.Status.Conditions, shared.ConditionSuspended)).To(BeTrue())
+			Expect(app.Status.Phase).To(Equal(shared.PhaseSuspended))
+
+			By("Resuming the Application")
+			app.Spec.Suspend = false
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(meta.FindStatusCondition(app.Status.Conditions, shared.ConditionSuspended)).To(BeNil())
+		})
+
+		It("should render a HorizontalPodAutoscaler when autoscaling is enabled", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Enabling autoscaling on the Application")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			cpu := int32(80)
+			app.Spec.Autoscaling = &appsv2.AutoscalingSpec{MaxReplicas: 5, TargetCPUUtilizationPercentage: &cpu}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, hpa)).To(Succeed())
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(resourceName))
+			Expect(hpa.Spec.Metrics).To(HaveLen(1))
+
+			By("Scaling the Deployment through the scale subresource like the HPA controller")
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			scale := &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 4}}
+			Expect(k8sClient.SubResource("scale").Update(ctx, dp, client.WithSubResourceBody(scale),
+				client.FieldOwner("kube-controller-manager"))).To(Succeed())
+
+			By("Disabling autoscaling again with different replicas")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Autoscaling = nil
+			app.Spec.Workflow.Replicas = ptr.To[int32](2)
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, hpa))).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(int32(2)))
+			Expect(ownsReplicas(dp)).To(BeTrue())
+			for _, entry := range dp.ManagedFields {
+				Expect(entry.Manager).NotTo(Equal(replicasHandoverFieldManager))
+			}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Conflicts).To(BeEmpty())
+		})
+
+		It("should render a PodDisruptionBudget only for more than one replica", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Enabling the disruption budget on a single replica Application")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Disruption = &appsv2.DisruptionSpec{}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			pdb := &policyv1.PodDisruptionBudget{}
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, pdb))).To(BeTrue())
+
+			By("Scaling the Application to four replicas")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			replicas := int32(4)
+			app.Spec.Workflow.Replicas = &replicas
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, pdb)).To(Succeed())
+			Expect(pdb.Spec.MaxUnavailable.IntValue()).To(Equal(1))
+		})
+
+		It("should route an Ingress to the Service and report the URLs", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Ingress = &appsv2.IngressSpec{
+				Hosts:         []appsv2.IngressHost{{Host: "test.example.com"}},
+				TLSSecretName: "test-tls",
+			}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			ing := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ing)).To(Succeed())
+			Expect(ing.Spec.Rules).To(HaveLen(1))
+			backend := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+			Expect(backend.Name).To(Equal(resourceName))
+			Expect(backend.Port.Number).To(Equal(int32(80)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.URLs).To(ConsistOf("https://test.example.com/"))
+		})
+
+		It("should report a condition when routes are set without the Gateway API", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Routes = []appsv2.HTTPRouteSpec{{
+				Name:       "public",
+				ParentRefs: []appsv2.RouteParentRef{{Name: "gateway"}},
+			}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			cond := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionRoutesReady)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(shared.ReasonGatewayAPINotInstalled))
+		})
+
+		It("should roll the pods out when the generated configuration changes", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Declaring configuration files and a Secret")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-credentials", Namespace: "default"},
+				StringData: map[string]string{"password": "secret"},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, secret)).To(Succeed()) })
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Config = &appsv2.ConfigSpec{Files: map[string]string{"app.yaml": "debug: false"}}
+			app.Spec.Secrets = []appsv2.SecretReference{{Name: secret.Name}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			checksum := dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]
+			Expect(checksum).NotTo(BeEmpty())
+			Expect(dp.Spec.Template.Spec.Volumes).To(HaveLen(1))
+			first := dp.Spec.Template.Spec.Volumes[0].ConfigMap.Name
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: first}, cm)).To(Succeed())
+			Expect(*cm.Immutable).To(BeTrue())
+			Expect(dp.Spec.Template.Spec.Containers[0].EnvFrom).To(HaveLen(1))
+
+			By("Changing the configuration files")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Config.Files["app.yaml"] = "debug: true"
+			app.Spec.Config.HistoryLimit = ptr.To[int32](0)
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]).NotTo(Equal(checksum))
+			Expect(dp.Spec.Template.Spec.Volumes[0].ConfigMap.Name).NotTo(Equal(first))
+			// 旧的ConfigMap不再被引用，historyLimit为0时被清理
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: first}, cm))).To(BeTrue())
+
+			By("Rotating the Secret")
+			checksum = dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+			secret.Data["password"] = []byte("rotated")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]).NotTo(Equal(checksum))
+		})
+
+		It("should run the pods as a dedicated ServiceAccount", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Identity = &appsv2.IdentitySpec{
+				Create:           true,
+				ImagePullSecrets: []string{"registry"},
+				Roles:            []appsv2.RoleReference{{Kind: "ClusterRole", Name: "view"}},
+			}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			sa := &corev1.ServiceAccount{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, sa)).To(Succeed())
+			Expect(sa.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "registry"}))
+			binding := &rbacv1.RoleBinding{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: resourceName + "-clusterrole-view"}, binding)).To(Succeed())
+			Expect(binding.Subjects).To(HaveLen(1))
+			Expect(binding.Subjects[0].Name).To(Equal(resourceName))
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.ServiceAccountName).To(Equal(resourceName))
+
+			By("Removing the roles")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Identity.Roles = nil
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(binding), binding))).To(BeTrue())
+		})
+
+		It("should render a NetworkPolicy that allows the declared peers", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Network = &appsv2.NetworkSpec{
+				IngressFrom: []appsv2.NetworkPeer{{Application: resourceName}, {Application: "missing"}},
+				EgressTo:    []appsv2.NetworkPeer{{CIDR: "10.0.0.0/8"}},
+			}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			np := &networkingv1.NetworkPolicy{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, np)).To(Succeed())
+			Expect(np.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress))
+			// 找不到的Application不生成规则，否则会放行所有流量
+			Expect(np.Spec.Ingress).To(HaveLen(1))
+			Expect(np.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(HaveKeyWithValue(shared.LabelApplicationUID, string(app.UID)))
+			Expect(np.Spec.Egress).To(HaveLen(2))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			cond := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionNetworkPolicyReady)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(shared.ReasonPeerNotFound))
+
+			By("Removing spec.network")
+			app.Spec.Network = nil
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, np))).To(BeTrue())
+		})
+
+		It("should switch the workload to a StatefulSet with a headless Service", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &k8sappsv1.Deployment{})).To(Succeed())
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workload = &appsv2.WorkloadSpec{
+				Kind:        appsv2.WorkloadStatefulSet,
+				StatefulSet: &appsv2.StatefulSetTemplate{PodManagementPolicy: k8sappsv1.ParallelPodManagement},
+			}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			sts := &k8sappsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, sts)).To(Succeed())
+			Expect(sts.Spec.ServiceName).To(Equal(resourceName + "-headless"))
+			Expect(sts.Spec.PodManagementPolicy).To(Equal(k8sappsv1.ParallelPodManagement))
+			headless := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: sts.Spec.ServiceName}, headless)).To(Succeed())
+			Expect(headless.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+			// 切换到StatefulSet后，之前生成的Deployment被删除
+			dp := &k8sappsv1.Deployment{}
+			err = k8sClient.Get(ctx, typeNamespacedName, dp)
+			Expect(errors.IsNotFound(err) || !dp.DeletionTimestamp.IsZero()).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionAvailable)).To(BeTrue())
+		})
+
+		It("should select the pods of a StatefulSet with a legacy selector from the headless Service", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workload = &appsv2.WorkloadSpec{Kind: appsv2.WorkloadStatefulSet}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+
+			By("Creating the StatefulSet with a selector written before the generated labels were used")
+			legacy := map[string]string{"app": resourceName}
+			sts := &k8sappsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: k8sappsv1.StatefulSetSpec{
+					ServiceName: resourceName + "-headless",
+					Selector:    &metav1.LabelSelector{MatchLabels: legacy},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: legacy},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+					},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(app, sts, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, sts)).To(Succeed())
+			DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, sts))).To(Succeed()) })
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, sts)).To(Succeed())
+			Expect(sts.Spec.Selector.MatchLabels).To(Equal(legacy))
+			headless := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: sts.Spec.ServiceName}, headless)).To(Succeed())
+			Expect(headless.Spec.Selector).To(Equal(legacy))
+		})
+
+		It("should hold the Deployment back until the dependencies are Available", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.DependsOn = []appsv2.ApplicationReference{{Name: "test-database"}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &k8sappsv1.Deployment{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			waiting := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionWaitingForDependencies)
+			Expect(waiting).NotTo(BeNil())
+			Expect(waiting.Status).To(Equal(metav1.ConditionTrue))
+			Expect(waiting.Message).To(ContainSubstring("default/test-database (not found)"))
+			Expect(app.Status.Phase).To(Equal(shared.PhasePending))
+
+			By("Creating the dependency and reporting it as Available")
+			database := &appsv2.Application{ObjectMeta: metav1.ObjectMeta{Name: "test-database", Namespace: "default"}}
+			database.Spec.Workflow.Replicas = ptr.To[int32](1)
+			database.Spec.Workflow.Template.Spec.Containers = []corev1.Container{{Name: "postgres", Image: "postgres:16"}}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+			DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, database))).To(Succeed()) })
+			database.Status.ObservedGeneration = database.Generation
+			meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+				Type: shared.ConditionAvailable, Status: metav1.ConditionTrue, Reason: shared.ReasonMinimumReplicasAvailable,
+			})
+			Expect(k8sClient.Status().Update(ctx, database)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &k8sappsv1.Deployment{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionWaitingForDependencies)).To(BeTrue())
+		})
+
+		It("should report the replicas and the selector for the scale subresource", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			selector, err := labels.Parse(app.Status.Selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector.Matches(labels.Set(selectorLabels(app)))).To(BeTrue())
+
+			By("Creating a stable pod, a canary pod and a pod that has already finished")
+			pods := map[string]corev1.PodPhase{"test-scale-stable": corev1.PodRunning, "test-scale-canary": corev1.PodPending, "test-scale-done": corev1.PodSucceeded}
+			for name, phase := range pods {
+				podLabels := selectorLabels(app)
+				if name == "test-scale-canary" {
+					podLabels[shared.LabelTrack] = "canary"
+				}
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: podLabels},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+				}
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed()) })
+				pod.Status.Phase = phase
+				Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+			}
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Replicas).To(Equal(int32(2)))
+		})
+
+		It("should report failing pods in the status and the Degraded condition", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+
+			By("Creating two pods of the Application whose container keeps crashing")
+			for _, name := range []string{"test-update-a", "test-update-b"} {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: selectorLabels(app)},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+				}
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				DeferCleanup(func() { Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed()) })
+				pod.Status.Phase = corev1.PodRunning
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name:         "nginx",
+					Image:        "nginx:1.14.2",
+					RestartCount: 4,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason: "CrashLoopBackOff",
+					}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Reason:   "OOMKilled",
+						ExitCode: 137,
+						Message:  "out of memory",
+					}},
+				}}
+				Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+			}
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.PodFailures).To(HaveLen(1))
+			failure := app.Status.PodFailures[0]
+			Expect(failure.Reason).To(Equal(appsv2.PodFailureOOMKilled))
+			Expect(failure.Container).To(Equal("nginx"))
+			Expect(failure.Pod).To(Equal("test-update-a"))
+			Expect(failure.Pods).To(Equal(int32(2)))
+			Expect(failure.RestartCount).To(Equal(int32(4)))
+			Expect(failure.Message).To(ContainSubstring("out of memory"))
+
+			degraded := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionDegraded)
+			Expect(degraded).NotTo(BeNil())
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal(shared.ReasonPodFailure))
+			Expect(degraded.Message).To(ContainSubstring("container nginx of pod test-update-a"))
+			Expect(app.Status.Phase).To(Equal(shared.PhaseDegraded))
+		})
+
+		It("should render a Deployment and a Service per component", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			api := appsv2.ComponentSpec{Name: "api"}
+			api.Workflow.Replicas = ptr.To[int32](2)
+			api.Workflow.Template.Spec.Containers = []corev1.Container{{Name: "api", Image: "nginx:1.14.2"}}
+			api.Service.Ports = []corev1.ServicePort{{Name: "http", Port: 8080}}
+			worker := appsv2.ComponentSpec{Name: "worker"}
+			worker.Workflow.Template.Spec.Containers = []corev1.Container{{Name: "worker", Image: "busybox"}}
+			app.Spec.Components = []appsv2.ComponentSpec{api, worker}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			apiName := types.NamespacedName{Namespace: "default", Name: resourceName + "-api"}
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, apiName, dp)).To(Succeed())
+			Expect(dp.Spec.Replicas).To(Equal(ptr.To[int32](2)))
+			Expect(dp.Spec.Template.Labels).To(HaveKeyWithValue(shared.LabelComponent, "api"))
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, apiName, svc)).To(Succeed())
+			Expect(svc.Spec.Selector).To(HaveKeyWithValue(shared.LabelInstance, resourceName+"-api"))
+			// 主Service的选择器不会选中组件的Pod
+			main := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, main)).To(Succeed())
+			Expect(main.Spec.Selector).To(HaveKeyWithValue(shared.LabelInstance, resourceName))
+
+			workerName := types.NamespacedName{Namespace: "default", Name: resourceName + "-worker"}
+			Expect(k8sClient.Get(ctx, workerName, &k8sappsv1.Deployment{})).To(Succeed())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, workerName, &corev1.Service{}))).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Components).To(HaveLen(2))
+			Expect(app.Status.Components[0].Name).To(Equal("api"))
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionAvailable)).To(BeTrue())
+
+			By("Removing the worker component")
+			app.Spec.Components = app.Spec.Components[:1]
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			removed := &k8sappsv1.Deployment{}
+			err = k8sClient.Get(ctx, workerName, removed)
+			Expect(errors.IsNotFound(err) || !removed.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+
+		It("should run the workload as a Job without a Service", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &corev1.Service{})).To(Succeed())
+
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workload = &appsv2.WorkloadSpec{
+				Kind: appsv2.WorkloadJob,
+				Job:  &appsv2.JobTemplate{BackoffLimit: ptr.To[int32](2)},
+			}
+			app.Spec.Service.Ports = nil
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			jobs := &batchv1.JobList{}
+			Expect(k8sClient.List(ctx, jobs, client.InNamespace("default"), client.MatchingLabels{shared.LabelInstance: resourceName})).To(Succeed())
+			Expect(jobs.Items).To(HaveLen(1))
+			job := jobs.Items[0]
+			Expect(job.Spec.BackoffLimit).To(Equal(ptr.To[int32](2)))
+			Expect(job.Spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+			// 切换到Job后，之前生成的Deployment和Service被删除
+			dp := &k8sappsv1.Deployment{}
+			err = k8sClient.Get(ctx, typeNamespacedName, dp)
+			Expect(errors.IsNotFound(err) || !dp.DeletionTimestamp.IsZero()).To(BeTrue())
+			svc := &corev1.Service{}
+			err = k8sClient.Get(ctx, typeNamespacedName, svc)
+			Expect(errors.IsNotFound(err) || !svc.DeletionTimestamp.IsZero()).To(BeTrue())
+
+			By("Reporting the finished Job in status")
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Succeeded = 1
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobSuccessCriteriaMet, Status: corev1.ConditionTrue, LastTransitionTime: now},
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: now},
+			}
+			Expect(k8sClient.Status().Update(ctx, &job)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Batch).NotTo(BeNil())
+			Expect(app.Status.Batch.Succeeded).To(Equal(int32(1)))
+			Expect(app.Status.Batch.Active).To(BeEmpty())
+			Expect(app.Status.Batch.LastSuccessfulTime).NotTo(BeNil())
+			Expect(app.Status.Batch.FinishedJob).To(Equal(job.Name))
+			Expect(meta.IsStatusConditionTrue(app.Status.Conditions, shared.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(app.Status.Conditions, shared.ConditionProgressing)).To(BeTrue())
+		})
+
+		It("should roll the pods out when a referenced ConfigMap changes", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-settings", Namespace: "default"},
+				Data:       map[string]string{"LOG_LEVEL": "info"},
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, cm)).To(Succeed()) })
+
+			By("Referencing the ConfigMap from the pod template")
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.Workflow.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: cm.Name}},
+			}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Annotations).NotTo(HaveKey(shared.AnnotationConfigChecksum))
+
+			By("Opting in to restarts on config changes")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.RestartOnConfigChange = true
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			Expect(configReferenceKeys(app)).To(ConsistOf("ConfigMap/" + cm.Name))
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			checksum := dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]
+			Expect(checksum).NotTo(BeEmpty())
+
+			By("Changing the ConfigMap")
+			cm.Data["LOG_LEVEL"] = "debug"
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Annotations[shared.AnnotationConfigChecksum]).NotTo(Equal(checksum))
+		})
+	})
+
+	Context("When a rollout strategy is configured", func() {
+		const resourceName = "test-rollout"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		canaryNamespacedName := types.NamespacedName{Name: resourceName + "-canary", Namespace: "default"}
+		greenNamespacedName := types.NamespacedName{Name: resourceName + "-green", Namespace: "default"}
+
+		BeforeEach(func() {
+			resource := &appsv2.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: appsv2.ApplicationSpec{
+					Workflow: shared.DeploymentTemplate{DeploymentSpec: k8sappsv1.DeploymentSpec{
+						Replicas: ptr.To[int32](4),
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+						},
+					}},
+					Service: shared.ServiceTemplate{ServiceSpec: corev1.ServiceSpec{
+						Ports: []corev1.ServicePort{{Port: 80}},
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &appsv2.Application{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if errors.IsNotFound(err) {
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Reconciling until the cleanup finalizer has been removed")
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			Eventually(func() bool {
+				_, _ = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				return errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv2.Application{}))
+			}).Should(BeTrue())
+		})
+
+		// startCanary 配置金丝雀发布的步骤，等待稳定版本创建完成后修改镜像，开始一次发布
+		startCanary := func(controllerReconciler *ApplicationReconciler, steps ...appsv2.CanaryStep) *appsv2.Application {
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.RolloutStrategy = &appsv2.RolloutStrategy{Canary: &appsv2.CanaryStrategy{Steps: steps}}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Creating the stable Deployment without a rollout")
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, canaryNamespacedName, &k8sappsv1.Deployment{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout).NotTo(BeNil())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			markRolledOut(ctx, typeNamespacedName)
+
+			By("Changing the image of the Application")
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			return app
+		}
+
+		// expectReplicas 检查稳定版本和金丝雀版本的镜像和副本数
+		expectReplicas := func(stable, canary int32) {
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(stable))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+			Expect(k8sClient.Get(ctx, canaryNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(canary))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+		}
+
+		It("should shift the replicas to the canary step by step and promote it", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := startCanary(controllerReconciler,
+				appsv2.CanaryStep{SetWeight: ptr.To[int32](25)},
+				appsv2.CanaryStep{Pause: &appsv2.CanaryPause{}},
+				appsv2.CanaryStep{SetWeight: ptr.To[int32](50)},
+				appsv2.CanaryStep{Pause: &appsv2.CanaryPause{Duration: &metav1.Duration{Duration: time.Hour}}},
+			)
+
+			By("Running the first weight step")
+			rollout := app.Status.Rollout
+			Expect(rollout.Phase).To(Equal(appsv2.RolloutProgressing))
+			Expect(rollout.CanaryRevision).NotTo(BeEmpty())
+			Expect(rollout.CanaryRevision).NotTo(Equal(rollout.StableRevision))
+			Expect(rollout.CurrentStepIndex).To(Equal(int32(0)))
+			Expect(rollout.CurrentWeight).To(Equal(int32(25)))
+			expectReplicas(3, 1)
+			canary := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, canaryNamespacedName, canary)).To(Succeed())
+			Expect(canary.Spec.Selector.MatchLabels).To(HaveKeyWithValue(shared.LabelTrack, trackCanary))
+			Expect(metav1.IsControlledBy(canary, app)).To(BeTrue())
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			Expect(labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(canary.Spec.Template.Labels))).To(BeTrue())
+
+			By("Pausing once the canary replicas are available")
+			markRolledOut(ctx, canaryNamespacedName)
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutPaused))
+			Expect(app.Status.Rollout.CurrentStepIndex).To(Equal(int32(1)))
+			Expect(app.Status.Rollout.Message).To(ContainSubstring(shared.RolloutActionResume))
+			progressing := meta.FindStatusCondition(app.Status.Conditions, shared.ConditionProgressing)
+			Expect(progressing).NotTo(BeNil())
+			Expect(progressing.Status).To(Equal(metav1.ConditionTrue))
+			Expect(progressing.Message).To(Equal(app.Status.Rollout.Message))
+			expectReplicas(3, 1)
+
+			By("Resuming the rollout")
+			app.Annotations = map[string]string{shared.AnnotationRolloutAction: shared.RolloutActionResume}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Annotations).NotTo(HaveKey(shared.AnnotationRolloutAction))
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutProgressing))
+			Expect(app.Status.Rollout.CurrentStepIndex).To(Equal(int32(2)))
+			Expect(app.Status.Rollout.CurrentWeight).To(Equal(int32(50)))
+			expectReplicas(2, 2)
+
+			By("Pausing for the configured duration")
+			markRolledOut(ctx, canaryNamespacedName)
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutPaused))
+			Expect(app.Status.Rollout.CurrentStepIndex).To(Equal(int32(3)))
+			Expect(app.Status.Rollout.PauseStartTime).NotTo(BeNil())
+			expectReplicas(2, 2)
+
+			By("Promoting the canary once the pause has expired")
+			app.Status.Rollout.PauseStartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+			Expect(k8sClient.Status().Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			Expect(app.Status.Rollout.CanaryRevision).To(BeEmpty())
+			Expect(app.Status.Rollout.CurrentWeight).To(BeZero())
+			Expect(app.Status.Rollout.PauseStartTime).To(BeNil())
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(int32(4)))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+			Expect(app.Status.Rollout.StableRevision).To(Equal(dp.Annotations[shared.AnnotationRevision]))
+
+			By("Deleting the canary Deployment after the stable Deployment has rolled out")
+			Expect(k8sClient.Get(ctx, canaryNamespacedName, &k8sappsv1.Deployment{})).To(Succeed())
+			markRolledOut(ctx, typeNamespacedName)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, canaryNamespacedName, &k8sappsv1.Deployment{}))).To(BeTrue())
+		})
+
+		It("should skip the remaining canary steps when promoted", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := startCanary(controllerReconciler,
+				appsv2.CanaryStep{SetWeight: ptr.To[int32](50)},
+				appsv2.CanaryStep{Pause: &appsv2.CanaryPause{}},
+			)
+			expectReplicas(2, 2)
+
+			app.Annotations = map[string]string{shared.AnnotationRolloutAction: shared.RolloutActionPromote}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Annotations).NotTo(HaveKey(shared.AnnotationRolloutAction))
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(int32(4)))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+		})
+
+		It("should keep the stable pod template when the canary rollout is aborted", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := startCanary(controllerReconciler,
+				appsv2.CanaryStep{SetWeight: ptr.To[int32](50)},
+				appsv2.CanaryStep{Pause: &appsv2.CanaryPause{}},
+			)
+			expectReplicas(2, 2)
+			revision := app.Status.Rollout.CanaryRevision
+
+			app.Annotations = map[string]string{shared.AnnotationRolloutAction: shared.RolloutActionAbort}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutAborted))
+			Expect(app.Status.Rollout.AbortedRevision).To(Equal(revision))
+			Expect(app.Status.Rollout.CanaryRevision).To(BeEmpty())
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(*dp.Spec.Replicas).To(Equal(int32(4)))
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.14.2"))
+
+			By("Staying aborted without starting the same rollout again")
+			markRolledOut(ctx, typeNamespacedName)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutAborted))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, canaryNamespacedName, &k8sappsv1.Deployment{}))).To(BeTrue())
+		})
+
+		// selectedColor 返回Service的selector选择的颜色
+		selectedColor := func(name string) string {
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, svc)).To(Succeed())
+			return svc.Spec.Selector[shared.LabelColor]
+		}
+
+		// startBlueGreen 配置蓝绿发布，等待blue Deployment创建完成后修改镜像，开始一次发布
+		startBlueGreen := func(controllerReconciler *ApplicationReconciler, strategy *appsv2.BlueGreenStrategy) *appsv2.Application {
+			app := &appsv2.Application{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			app.Spec.RolloutStrategy = &appsv2.RolloutStrategy{BlueGreen: strategy}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Creating only the blue Deployment without a rollout")
+			blue := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, blue)).To(Succeed())
+			Expect(blue.Spec.Template.Labels).To(HaveKeyWithValue(shared.LabelColor, shared.ColorBlue))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, greenNamespacedName, &k8sappsv1.Deployment{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.ActiveColor).To(Equal(shared.ColorBlue))
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorBlue))
+			markRolledOut(ctx, typeNamespacedName)
+
+			By("Changing the image of the Application")
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.25"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			return app
+		}
+
+		// expectImages 检查blue和green Deployment的镜像和副本数
+		expectImages := func(blueImage string, blueReplicas int32, greenImage string, greenReplicas int32) {
+			dp := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal(blueImage))
+			Expect(*dp.Spec.Replicas).To(Equal(blueReplicas))
+			Expect(k8sClient.Get(ctx, greenNamespacedName, dp)).To(Succeed())
+			Expect(dp.Spec.Template.Spec.Containers[0].Image).To(Equal(greenImage))
+			Expect(*dp.Spec.Replicas).To(Equal(greenReplicas))
+		}
+
+		It("should switch the main Service to the new color only after the promote action", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := startBlueGreen(controllerReconciler, &appsv2.BlueGreenStrategy{
+				ScaleDownDelay: &metav1.Duration{Duration: time.Hour},
+			})
+
+			By("Rolling the new pod template out to the green Deployment behind the preview Service")
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutProgressing))
+			Expect(app.Status.Rollout.PreviewRevision).NotTo(BeEmpty())
+			expectImages("nginx:1.14.2", 4, "nginx:1.25", 4)
+			green := &k8sappsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, greenNamespacedName, green)).To(Succeed())
+			Expect(green.Spec.Selector.MatchLabels).To(HaveKeyWithValue(shared.LabelColor, shared.ColorGreen))
+			Expect(green.Spec.Template.Labels).To(HaveKeyWithValue(shared.LabelColor, shared.ColorGreen))
+			Expect(metav1.IsControlledBy(green, app)).To(BeTrue())
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorBlue))
+			Expect(selectedColor(resourceName + "-preview")).To(Equal(shared.ColorGreen))
+
+			By("Waiting for the promote action once the green Deployment is available")
+			markRolledOut(ctx, greenNamespacedName)
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutPaused))
+			Expect(app.Status.Rollout.Message).To(ContainSubstring(shared.RolloutActionPromote))
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorBlue))
+
+			By("Promoting the green Deployment")
+			app.Annotations = map[string]string{shared.AnnotationRolloutAction: shared.RolloutActionPromote}
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.ActiveColor).To(Equal(shared.ColorGreen))
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			Expect(app.Status.Rollout.ScaleDownTime).NotTo(BeNil())
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorGreen))
+			Expect(selectedColor(resourceName + "-preview")).To(Equal(shared.ColorBlue))
+			// 旧颜色在scaleDownDelay到期之前保留副本
+			expectImages("nginx:1.14.2", 4, "nginx:1.25", 4)
+
+			By("Scaling the blue Deployment down once the scale down delay has expired")
+			app.Status.Rollout.ScaleDownTime = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+			Expect(k8sClient.Status().Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.ScaleDownTime).To(BeNil())
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorGreen))
+			expectImages("nginx:1.14.2", 0, "nginx:1.25", 4)
+		})
+
+		It("should promote automatically and roll back to the previous color at once", func() {
+			controllerReconciler := &ApplicationReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			app := startBlueGreen(controllerReconciler, &appsv2.BlueGreenStrategy{
+				AutoPromotion:  true,
+				ScaleDownDelay: &metav1.Duration{Duration: time.Hour},
+			})
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutProgressing))
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorBlue))
+
+			By("Promoting the green Deployment as soon as it is available")
+			markRolledOut(ctx, greenNamespacedName)
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.ActiveColor).To(Equal(shared.ColorGreen))
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorGreen))
+			expectImages("nginx:1.14.2", 4, "nginx:1.25", 4)
+
+			By("Restoring the previous image while the blue Deployment still has its replicas")
+			app.Spec.Workflow.Template.Spec.Containers[0].Image = "nginx:1.14.2"
+			Expect(k8sClient.Update(ctx, app)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, app)).To(Succeed())
+			Expect(app.Status.Rollout.ActiveColor).To(Equal(shared.ColorBlue))
+			Expect(app.Status.Rollout.Phase).To(Equal(appsv2.RolloutHealthy))
+			Expect(selectedColor(resourceName)).To(Equal(shared.ColorBlue))
+			Expect(selectedColor(resourceName + "-preview")).To(Equal(shared.ColorGreen))
+			expectImages("nginx:1.14.2", 4, "nginx:1.25", 4)
+		})
+	})
 })
+
+// markRolledOut 模拟Deployment控制器完成滚动更新：envtest中没有运行Deployment控制器，Deployment的状态需要手动更新
+func markRolledOut(ctx context.Context, key types.NamespacedName) {
+	dp := &k8sappsv1.Deployment{}
+	Expect(k8sClient.Get(ctx, key, dp)).To(Succeed())
+	replicas := desiredReplicas(dp.Spec.Replicas)
+	dp.Status = k8sappsv1.DeploymentStatus{
+		ObservedGeneration: dp.Generation,
+		Replicas:           replicas,
+		UpdatedReplicas:    replicas,
+		ReadyReplicas:      replicas,
+		AvailableReplicas:  replicas,
+	}
+	Expect(k8sClient.Status().Update(ctx, dp)).To(Succeed())
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/csaupgrade"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// FieldManager 是控制器进行Server-Side Apply时使用的字段管理者名称，
+// 子资源中由控制器写入的字段都归属于这个manager
+const FieldManager = "application-operator"
+
+// legacyFieldManagers 是以Update方式修改子资源的manager：改用Server-Side Apply之前控制器自己通过Create和Update写入的字段
+// （manager为可执行文件的名称），以及kubectl edit、label等命令式的手工修改。
+// 以apply方式管理字段的其他actor（HPA、kubectl apply --server-side、服务网格注入器）不在其中，它们的字段仍然按照冲突处理
+var legacyFieldManagers = sets.New(
+	strings.Split(rest.DefaultKubernetesUserAgent(), "/")[0],
+	"manager",
+	"kubectl-edit",
+	"kubectl-patch",
+	"kubectl-label",
+	"kubectl-annotate",
+	"kubectl-set",
+	"kubectl-replace",
+	"kubectl-client-side-apply",
+)
+
+// apply 以Server-Side Apply的方式提交子资源，obj必须设置好apiVersion和kind。
+// 只有Application开启了spec.forceOwnership时，才会强制接管其他manager（例如HPA、kubectl、服务网格注入器）拥有的字段
+func (r *ApplicationReconciler) apply(ctx context.Context, app *v2.Application, obj client.Object) error {
+	if err := r.upgradeManagedFields(ctx, obj); err != nil {
+		return err
+	}
+	opts := []client.PatchOption{client.FieldOwner(FieldManager)}
+	if app.Spec.ForceOwnership {
+		opts = append(opts, client.ForceOwnership)
+	}
+	return r.Patch(ctx, obj, client.Apply, opts...)
+}
+
+// setFieldConflict 在Application状态中记录子资源的字段冲突，message为空表示冲突已解除
+func setFieldConflict(app *v2.Application, kind, name, message string) {
+	for i, c := range app.Status.Conflicts {
+		if c.Kind != kind || c.Name != name {
+			continue
+		}
+		if message == "" {
+			app.Status.Conflicts = append(app.Status.Conflicts[:i], app.Status.Conflicts[i+1:]...)
+		} else {
+			app.Status.Conflicts[i].Message = message
+		}
+		return
+	}
+	if message != "" {
+		app.Status.Conflicts = append(app.Status.Conflicts, shared.FieldConflict{Kind: kind, Name: name, Message: message})
+	}
+}
+
+// conflictResult 存在字段冲突时，一段时间后重新调谐，以便冲突解除后状态能够及时更新
+func conflictResult(conflict string) ctrl.Result {
+	if conflict == "" {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: GenericRequeueDuration}
+}
+
+// upgradeManagedFields 把legacyFieldManagers拥有的字段转移给FieldManager。转移之后这些字段只归控制器所有，
+// 随后的apply会删除Application中已经不再声明的字段，并且还原手工修改过的值，而不是把它们当作冲突
+func (r *ApplicationReconciler) upgradeManagedFields(ctx context.Context, obj client.Object) error {
+	var live client.Object
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		live = u
+	} else if gvk.Group == "" && (gvk.Kind == "ConfigMap" || gvk.Kind == "Secret") {
+		// managedFields属于元数据，ConfigMap和Secret只以元数据的形式缓存，按类型读取会为它们建立完整的informer
+		m := &metav1.PartialObjectMetadata{}
+		m.SetGroupVersionKind(gvk)
+		live = m
+	} else {
+		created, err := r.Scheme.New(gvk)
+		if err != nil {
+			return err
+		}
+		live = created.(client.Object)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(live, legacyFieldManagers, FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	if err := r.Patch(ctx, live, client.RawPatch(types.JSONPatchType, patch)); err != nil {
+		// 补丁中带有resourceVersion，缓存中的对象过期时返回409。这不是字段冲突，不能按照冲突报告，等待下一次调谐重试
+		if errors.IsConflict(err) {
+			return fmt.Errorf("the managed fields of %s %s changed while being upgraded, will retry", live.GetObjectKind().GroupVersionKind().Kind, live.GetName())
+		}
+		return err
+	}
+	log.FromContext(ctx).Info("The fields written by the legacy field managers have been moved to the operator.",
+		"kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+	return nil
+}
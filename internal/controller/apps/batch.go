@@ -0,0 +1,355 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// batchEnabled 判断Application是否以Job或者CronJob运行
+func batchEnabled(app *v2.Application) bool {
+	kind := workloadKind(app)
+	return kind == v2.WorkloadJob || kind == v2.WorkloadCronJob
+}
+
+// reconcileJob 以Job运行时生成一个Job。Job的Pod模板是不可变的，因此名称中带有渲染结果的哈希值：
+// 模板变化时创建新的Job，并删除之前模板生成的Job
+func (r *ApplicationReconciler) reconcileJob(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.deleteOtherWorkloads(ctx, app); err != nil {
+		log.Error(err, "Failed to delete the previous workloads, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	cfg, err := r.reconcileConfig(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile the configuration, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	job := buildJob(app, cfg)
+
+	jobs, err := r.listJobs(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to list Jobs, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	var live *batchv1.Job
+	for i := range jobs {
+		existing := &jobs[i]
+		if !metav1.IsControlledBy(existing, app) {
+			continue
+		}
+		if existing.Name == job.Name {
+			live = existing
+			continue
+		}
+		if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete the previous Job, will requeue after a short time.", "job", existing.Name)
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The Job of the previous template has been deleted.", "job", existing.Name)
+	}
+
+	// 已经运行结束的Job被删除（例如ttlSecondsAfterFinished到期）后不再重新运行，直到模板发生变化
+	var conflict string
+	if live == nil && app.Status.Batch != nil && app.Status.Batch.FinishedJob == job.Name {
+		log.Info("The Job has finished and been removed, it is not run again.", "job", job.Name)
+	} else {
+		if err := ctrl.SetControllerReference(app, job, r.Scheme); err != nil {
+			log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if err := r.checkOwnership(ctx, app, job, nil); err != nil {
+			log.Error(err, "Failed to check the ownership of the Job.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		err = r.apply(ctx, app, job)
+		switch {
+		case err == nil:
+			log.Info("The Job has been applied.", "job", job.Name)
+		case errors.IsConflict(err):
+			log.Info("The Job has field conflicts with other managers.", "conflict", err.Error())
+			conflict = err.Error()
+		default:
+			log.Error(err, "Failed to apply Job, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, "Job", job.Name, conflict)
+	}
+
+	if _, err := r.observeBatch(ctx, app); err != nil {
+		log.Error(err, "Failed to observe the Jobs, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if live != nil && jobFinished(live) != nil {
+		app.Status.Batch.FinishedJob = live.Name
+	}
+
+	if err := r.pruneConfigMaps(ctx, app, &job.Spec.Template); err != nil {
+		log.Error(err, "Failed to prune the old ConfigMaps, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	return conflictResult(conflict), nil
+}
+
+// reconcileCronJob 以CronJob运行时生成一个与Application同名的CronJob，由它按照spec.workload.cronJob.schedule创建Job
+func (r *ApplicationReconciler) reconcileCronJob(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.deleteOtherWorkloads(ctx, app); err != nil {
+		log.Error(err, "Failed to delete the previous workloads, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	cfg, err := r.reconcileConfig(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile the configuration, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	cronJob := buildCronJob(app, cfg)
+	if err := ctrl.SetControllerReference(app, cronJob, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, cronJob, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the CronJob.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err = r.apply(ctx, app, cronJob)
+	switch {
+	case err == nil:
+		log.Info("The CronJob has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The CronJob has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+	default:
+		log.Error(err, "Failed to apply CronJob, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "CronJob", cronJob.Name, conflict)
+
+	jobs, err := r.observeBatch(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to observe the Jobs, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	// 正在运行的Job可能还在使用之前模板生成的ConfigMap，清理时需要保留
+	templates := []*corev1.PodTemplateSpec{&cronJob.Spec.JobTemplate.Spec.Template}
+	for i := range jobs {
+		if jobFinished(&jobs[i]) == nil {
+			templates = append(templates, &jobs[i].Spec.Template)
+		}
+	}
+	if err := r.pruneConfigMaps(ctx, app, templates...); err != nil {
+		log.Error(err, "Failed to prune the old ConfigMaps, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	return conflictResult(conflict), nil
+}
+
+// buildJobSpec 构造Job和CronJob共用的JobSpec：Pod模板来自spec.workflow.template，其余字段来自spec.workload.job
+func buildJobSpec(app *v2.Application, cfg *renderedConfig) batchv1.JobSpec {
+	spec := batchv1.JobSpec{}
+	spec.Template = *app.Spec.Workflow.Template.DeepCopy()
+	spec.Template.SetLabels(podTemplateLabels(app, nil))
+	injectConfig(&spec.Template, cfg)
+	injectIdentity(app, &spec.Template)
+	// Job的Pod只能使用Never或者OnFailure重启策略，Deployment默认的Always改为OnFailure
+	if spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		spec.Template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+	}
+
+	if template := app.Spec.Workload.Job; template != nil {
+		spec.Parallelism = template.Parallelism
+		spec.Completions = template.Completions
+		spec.BackoffLimit = template.BackoffLimit
+		spec.ActiveDeadlineSeconds = template.ActiveDeadlineSeconds
+		spec.TTLSecondsAfterFinished = template.TTLSecondsAfterFinished
+	}
+	return spec
+}
+
+// buildJob 构造Job kind对应的Job，名称为<application>-<JobSpec的哈希值>。
+// selector由Job控制器根据controller-uid生成，这里不需要设置
+func buildJob(app *v2.Application, cfg *renderedConfig) *batchv1.Job {
+	spec := buildJobSpec(app, cfg)
+
+	job := &batchv1.Job{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	job.SetGroupVersionKind(batchv1.SchemeGroupVersion.WithKind("Job"))
+	job.SetName(app.Name + "-" + computeHash(spec))
+	job.SetNamespace(app.Namespace)
+	job.SetLabels(childLabels(app))
+	job.Spec = spec
+	return job
+}
+
+// buildCronJob 构造CronJob kind对应的CronJob，它创建的Job同样带有Application的选择器标签，便于统计运行情况
+func buildCronJob(app *v2.Application, cfg *renderedConfig) *batchv1.CronJob {
+	cronJob := &batchv1.CronJob{}
+	cronJob.SetGroupVersionKind(batchv1.SchemeGroupVersion.WithKind("CronJob"))
+	cronJob.SetName(app.Name)
+	cronJob.SetNamespace(app.Namespace)
+	cronJob.SetLabels(childLabels(app))
+
+	if template := app.Spec.Workload.CronJob; template != nil {
+		cronJob.Spec.Schedule = template.Schedule
+		cronJob.Spec.TimeZone = template.TimeZone
+		cronJob.Spec.ConcurrencyPolicy = template.ConcurrencyPolicy
+		cronJob.Spec.StartingDeadlineSeconds = template.StartingDeadlineSeconds
+		cronJob.Spec.SuccessfulJobsHistoryLimit = template.SuccessfulJobsHistoryLimit
+		cronJob.Spec.FailedJobsHistoryLimit = template.FailedJobsHistoryLimit
+	}
+	cronJob.Spec.JobTemplate.SetLabels(childLabels(app))
+	cronJob.Spec.JobTemplate.Spec = buildJobSpec(app, cfg)
+	return cronJob
+}
+
+// listJobs 列出带有Application选择器标签的Job，包括它的CronJob创建的Job
+func (r *ApplicationReconciler) listJobs(ctx context.Context, app *v2.Application) ([]batchv1.Job, error) {
+	list := &batchv1.JobList{}
+	if err := r.List(ctx, list, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app))); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// observeBatch 根据现存的Job汇总Job或CronJob工作负载的运行情况，返回属于Application的Job。
+// 已经被删除的Job不再计数，但上一次运行、成功和失败的时间会保留下来
+func (r *ApplicationReconciler) observeBatch(ctx context.Context, app *v2.Application) ([]batchv1.Job, error) {
+	var cronJob *batchv1.CronJob
+	if workloadKind(app) == v2.WorkloadCronJob {
+		cronJob = &batchv1.CronJob{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, cronJob); err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, err
+			}
+			cronJob = nil
+		}
+	}
+
+	jobs, err := r.listJobs(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &v2.BatchStatus{}
+	if previous := app.Status.Batch; previous != nil {
+		status.LastScheduleTime = previous.LastScheduleTime
+		status.LastSuccessfulTime = previous.LastSuccessfulTime
+		status.LastFailureTime = previous.LastFailureTime
+		status.FinishedJob = previous.FinishedJob
+	}
+
+	var owned []batchv1.Job
+	for _, job := range jobs {
+		// 只统计由Application直接创建的Job，或者由它的CronJob创建的Job
+		if !metav1.IsControlledBy(&job, app) && (cronJob == nil || !metav1.IsControlledBy(&job, cronJob)) {
+			continue
+		}
+		if !job.DeletionTimestamp.IsZero() {
+			continue
+		}
+		owned = append(owned, job)
+
+		status.LastScheduleTime = latestTime(status.LastScheduleTime, job.Status.StartTime)
+		c := jobFinished(&job)
+		switch {
+		case c == nil:
+			status.Active = append(status.Active, job.Name)
+		case c.Type == batchv1.JobComplete:
+			status.Succeeded++
+			status.LastSuccessfulTime = latestTime(status.LastSuccessfulTime, job.Status.CompletionTime)
+		default:
+			status.Failed++
+			status.LastFailureTime = latestTime(status.LastFailureTime, &c.LastTransitionTime)
+		}
+	}
+	if cronJob != nil {
+		status.LastScheduleTime = latestTime(status.LastScheduleTime, cronJob.Status.LastScheduleTime)
+		status.LastSuccessfulTime = latestTime(status.LastSuccessfulTime, cronJob.Status.LastSuccessfulTime)
+	}
+	sort.Strings(status.Active)
+
+	app.Status.Batch = status
+	// Job和CronJob没有需要保持可用的副本
+	app.Status.Workflow = appsv1.DeploymentStatus{}
+	return owned, nil
+}
+
+// jobFinished 返回Job已经结束时的Complete或者Failed condition，仍在运行时返回nil
+func jobFinished(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		c := &job.Status.Conditions[i]
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
+
+// latestTime 返回两个时间中较晚的一个，nil表示没有记录
+func latestTime(a, b *metav1.Time) *metav1.Time {
+	if b == nil || (a != nil && !a.Before(b)) {
+		return a
+	}
+	return b.DeepCopy()
+}
+
+// lastRunFailed 判断最近一次结束的运行是否失败
+func lastRunFailed(batch *v2.BatchStatus) bool {
+	if batch == nil || batch.LastFailureTime == nil {
+		return false
+	}
+	return batch.LastSuccessfulTime == nil || batch.LastSuccessfulTime.Before(batch.LastFailureTime)
+}
+
+// batchConditions 计算Job和CronJob工作负载的Available和Progressing condition：
+// 最近一次运行失败时不可用，有正在运行的Job时认为在运行中
+func batchConditions(batch *v2.BatchStatus) (available, progressing metav1.Condition) {
+	if batch == nil {
+		batch = &v2.BatchStatus{}
+	}
+
+	available = metav1.Condition{
+		Type:    shared.ConditionAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  shared.ReasonAsExpected,
+		Message: fmt.Sprintf("%d succeeded and %d failed Jobs", batch.Succeeded, batch.Failed),
+	}
+	if lastRunFailed(batch) {
+		available.Status = metav1.ConditionFalse
+		available.Reason = shared.ReasonJobFailed
+	}
+
+	progressing = metav1.Condition{
+		Type:    shared.ConditionProgressing,
+		Status:  metav1.ConditionFalse,
+		Reason:  shared.ReasonJobsIdle,
+		Message: "No Job is running",
+	}
+	if len(batch.Active) > 0 {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = shared.ReasonJobActive
+		progressing.Message = "Running " + strings.Join(batch.Active, ", ")
+	}
+	return available, progressing
+}
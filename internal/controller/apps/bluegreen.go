@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// 未设置scaleDownDelay时，旧颜色在提升之后保留副本的时间
+const DefaultScaleDownDelay = 30 * time.Second
+
+// greenName 返回green Deployment的名称，blue Deployment沿用Application的名称
+func greenName(app *v2.Application) string {
+	return app.Name + "-green"
+}
+
+// previewServiceName 返回预览Service的名称
+func previewServiceName(app *v2.Application) string {
+	return app.Name + "-preview"
+}
+
+// blueGreenEnabled 判断Application是否配置了蓝绿发布策略
+func blueGreenEnabled(app *v2.Application) bool {
+	return app.Spec.RolloutStrategy != nil && app.Spec.RolloutStrategy.BlueGreen != nil
+}
+
+// activeColor 返回主Service应该选择的颜色。没有使用蓝绿发布，或者现有的Pod还没有颜色标签时返回空字符串
+func activeColor(app *v2.Application) string {
+	if !blueGreenEnabled(app) || app.Status.Rollout == nil {
+		return ""
+	}
+	return app.Status.Rollout.ActiveColor
+}
+
+func otherColor(color string) string {
+	if color == shared.ColorBlue {
+		return shared.ColorGreen
+	}
+	return shared.ColorBlue
+}
+
+// serviceSelector 在podSelector返回的标签pods的基础上计算主Service的selector，使用蓝绿发布时只选择当前生效颜色的Pod
+func serviceSelector(app *v2.Application, pods map[string]string) map[string]string {
+	if color := activeColor(app); color != "" {
+		return mergeLabels(pods, map[string]string{shared.LabelColor: color})
+	}
+	return pods
+}
+
+// planBlueGreen 推进蓝绿发布：新的Pod模板先发布到非生效的颜色上，由预览Service提供访问，
+// 提升时只需要切换主Service的selector，旧颜色在scaleDownDelay到期后缩容到0。
+// blue为期望的blue Deployment（即主Deployment），会被就地修改；live为集群中现存的blue Deployment，不存在时为nil。
+// 返回期望的green Deployment，不需要它时返回nil
+func (r *ApplicationReconciler) planBlueGreen(ctx context.Context, app *v2.Application, blue, live *appsv1.Deployment) (*appsv1.Deployment, time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	strategy := app.Spec.RolloutStrategy.BlueGreen
+	revision := blue.Annotations[shared.AnnotationRevision]
+	replicas := desiredReplicas(app.Spec.Workflow.Replicas)
+
+	status := app.Status.Rollout
+	if status == nil || status.ActiveColor == "" {
+		// 从其他发布方式切换过来时，现有的Pod还没有颜色标签：先给blue Deployment加上颜色标签并等待滚动完成，
+		// 在此之前主Service继续使用不带颜色的selector，避免切换selector时没有可用的Endpoint
+		if live != nil && (live.Spec.Template.Labels[shared.LabelColor] != shared.ColorBlue || !deploymentRolledOut(live)) {
+			setColor(blue, shared.ColorBlue)
+			app.Status.Rollout = &v2.RolloutStatus{
+				Phase:   v2.RolloutProgressing,
+				Message: "Adding the color label to the pods of the blue Deployment",
+			}
+			return nil, 0, nil
+		}
+		status = &v2.RolloutStatus{ActiveColor: shared.ColorBlue, StableRevision: revision}
+		if live != nil && live.Annotations[shared.AnnotationRevision] != "" {
+			status.StableRevision = live.Annotations[shared.AnnotationRevision]
+		}
+		app.Status.Rollout = status
+	}
+
+	green, err := r.getDeployment(ctx, app, greenName(app))
+	if err != nil {
+		return nil, 0, err
+	}
+	lives := map[string]*appsv1.Deployment{shared.ColorBlue: live, shared.ColorGreen: green}
+	// 生效颜色的Deployment还不存在时，直接使用最新的Pod模板创建，不需要发布
+	if lives[status.ActiveColor] == nil {
+		status.StableRevision = revision
+	}
+
+	action, err := r.takeRolloutAction(ctx, app)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	preview := otherColor(status.ActiveColor)
+	switch revision {
+	case status.StableRevision:
+		status.PreviewRevision = ""
+		status.Phase = v2.RolloutHealthy
+		status.Message = fmt.Sprintf("The %s Deployment serves all traffic", status.ActiveColor)
+	case status.AbortedRevision:
+		status.PreviewRevision = ""
+		status.Phase = v2.RolloutAborted
+		status.Message = fmt.Sprintf("The rollout was aborted, the %s Deployment serves all traffic", status.ActiveColor)
+	default:
+		if status.PreviewRevision != revision {
+			log.Info("Starting a blue/green rollout.", "previewColor", preview, "revision", revision)
+			status.PreviewRevision = revision
+			status.AbortedRevision = ""
+			status.ScaleDownTime = nil
+		}
+		ready := workloadReady(lives[preview], revision, replicas)
+		switch {
+		case action == shared.RolloutActionAbort:
+			log.Info("Aborting the blue/green rollout.", "revision", revision)
+			status.AbortedRevision = revision
+			status.PreviewRevision = ""
+			status.ScaleDownTime = nil
+			status.Phase = v2.RolloutAborted
+			status.Message = fmt.Sprintf("The rollout was aborted, the %s Deployment serves all traffic", status.ActiveColor)
+		case action == shared.RolloutActionPromote || (strategy.AutoPromotion && ready):
+			// 提升：主Service切换到预览颜色，旧颜色在scaleDownDelay到期之前保留副本，以便立即切换回去
+			log.Info("Promoting the preview color.", "activeColor", preview, "revision", revision)
+			status.ActiveColor, preview = preview, status.ActiveColor
+			status.StableRevision = revision
+			status.PreviewRevision = ""
+			status.ScaleDownTime = &metav1.Time{Time: time.Now().Add(scaleDownDelay(strategy))}
+			status.Phase = v2.RolloutHealthy
+			status.Message = fmt.Sprintf("The %s Deployment has been promoted", status.ActiveColor)
+		case ready:
+			status.Phase = v2.RolloutPaused
+			status.Message = fmt.Sprintf("The %s Deployment is available behind the preview Service, waiting for the %s action",
+				preview, shared.RolloutActionPromote)
+		default:
+			status.Phase = v2.RolloutProgressing
+			status.Message = fmt.Sprintf("Waiting for the %s Deployment to become available", preview)
+		}
+	}
+
+	desired := map[string]*appsv1.Deployment{shared.ColorBlue: blue, shared.ColorGreen: buildGreenDeployment(app, blue)}
+
+	// 生效的颜色使用稳定版本的Pod模板和全部副本
+	active := desired[status.ActiveColor]
+	if status.StableRevision != revision {
+		keepLiveTemplate(active, lives[status.ActiveColor])
+	}
+	active.Spec.Replicas = ptr.To(replicas)
+	setColor(active, status.ActiveColor)
+
+	var requeueAfter time.Duration
+	standby := desired[preview]
+	switch {
+	case status.PreviewRevision != "":
+		// 发布进行中：新的Pod模板运行在预览颜色上
+		standby.Spec.Replicas = ptr.To(replicas)
+	case lives[preview] == nil:
+		standby.Spec.Replicas = ptr.To(int32(0))
+	default:
+		// 没有正在进行的发布：预览颜色保留之前的Pod模板，在scaleDownDelay到期之后缩容到0
+		keepLiveTemplate(standby, lives[preview])
+		standby.Spec.Replicas = ptr.To(int32(0))
+		if status.ScaleDownTime != nil {
+			if remaining := time.Until(status.ScaleDownTime.Time); remaining > 0 {
+				standby.Spec.Replicas = ptr.To(replicas)
+				requeueAfter = remaining
+			} else {
+				log.Info("Scaling down the previous color.", "color", preview)
+				status.ScaleDownTime = nil
+			}
+		}
+	}
+	setColor(standby, preview)
+
+	// green Deployment只在需要时创建，blue Deployment作为主Deployment总是会被提交
+	if status.ActiveColor == shared.ColorBlue && status.PreviewRevision == "" && green == nil {
+		return nil, requeueAfter, nil
+	}
+	return desired[shared.ColorGreen], requeueAfter, nil
+}
+
+// buildGreenDeployment 以blue Deployment为基础构造green Deployment，它的selector在blue Deployment的selector上额外包含颜色标签，
+// 避免选中blue Deployment的Pod，同时两个颜色的Pod都能被podSelector选中
+func buildGreenDeployment(app *v2.Application, blue *appsv1.Deployment) *appsv1.Deployment {
+	dp := blue.DeepCopy()
+	dp.SetName(greenName(app))
+	dp.SetOwnerReferences(nil)
+	dp.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: mergeLabels(blue.Spec.Selector.MatchLabels, map[string]string{shared.LabelColor: shared.ColorGreen}),
+	}
+	dp.Spec.Template.SetLabels(mergeLabels(dp.Spec.Template.Labels, dp.Spec.Selector.MatchLabels))
+	return dp
+}
+
+// setColor 在Pod模板上设置颜色标签
+func setColor(dp *appsv1.Deployment, color string) {
+	dp.Spec.Template.SetLabels(mergeLabels(dp.Spec.Template.Labels, map[string]string{shared.LabelColor: color}))
+}
+
+// keepLiveTemplate 让Deployment继续使用集群中现存的Pod模板
+func keepLiveTemplate(dp, live *appsv1.Deployment) {
+	if live == nil {
+		return
+	}
+	dp.Spec.Template = *live.Spec.Template.DeepCopy()
+	dp.Annotations[shared.AnnotationRevision] = live.Annotations[shared.AnnotationRevision]
+}
+
+func scaleDownDelay(strategy *v2.BlueGreenStrategy) time.Duration {
+	if strategy.ScaleDownDelay == nil {
+		return DefaultScaleDownDelay
+	}
+	return strategy.ScaleDownDelay.Duration
+}
+
+// reconcilePreviewService 使用蓝绿发布时提交选择预览颜色的Service，否则删除它
+func (r *ApplicationReconciler) reconcilePreviewService(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	color := activeColor(app)
+	if color == "" {
+		existing := &corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: previewServiceName(app)}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete the preview Service, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The preview Service has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	pods, err := r.podSelector(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to get the selector of the workload, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	svc := buildPreviewService(app, otherColor(color), pods)
+	if err := ctrl.SetControllerReference(app, svc, r.Scheme); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, svc, nil); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.apply(ctx, app, svc); err != nil {
+		if errors.IsConflict(err) {
+			setFieldConflict(app, "Service", svc.Name, err.Error())
+			return conflictResult(err.Error()), nil
+		}
+		log.Error(err, "Failed to apply the preview Service, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Service", svc.Name, "")
+	return ctrl.Result{}, nil
+}
+
+// buildPreviewService 构造选择预览颜色的ClusterIP Service，端口与主Service相同，pods为podSelector返回的标签
+func buildPreviewService(app *v2.Application, color string, pods map[string]string) *corev1.Service {
+	svc := &corev1.Service{}
+	svc.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+	svc.SetName(previewServiceName(app))
+	svc.SetNamespace(app.Namespace)
+	svc.SetLabels(childLabels(app))
+	for _, port := range app.Spec.Service.Ports {
+		// 预览Service总是ClusterIP类型，不能复用主Service的nodePort
+		port.NodePort = 0
+		svc.Spec.Ports = append(svc.Spec.Ports, port)
+	}
+	svc.Spec.Selector = mergeLabels(pods, map[string]string{shared.LabelColor: color})
+	return svc
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// 金丝雀版本Pod上apps.wuyong.cn/track标签的取值
+const trackCanary = "canary"
+
+// canaryName 返回金丝雀版本Deployment的名称
+func canaryName(app *v2.Application) string {
+	return app.Name + "-canary"
+}
+
+// canaryEnabled 判断Application是否配置了金丝雀发布策略
+func canaryEnabled(app *v2.Application) bool {
+	return app.Spec.RolloutStrategy != nil && app.Spec.RolloutStrategy.Canary != nil
+}
+
+// planCanary 推进金丝雀发布的步骤，并据此调整稳定版本Deployment（stable）的Pod模板和副本数，返回期望的金丝雀版本Deployment。
+// 没有正在进行的发布时返回nil，此时stable使用最新的Pod模板和全部副本。live为集群中现存的稳定版本Deployment，不存在时为nil。
+// 返回的time.Duration表示暂停步骤需要在多久之后重新调谐
+func (r *ApplicationReconciler) planCanary(ctx context.Context, app *v2.Application, stable, live *appsv1.Deployment) (*appsv1.Deployment, time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	steps := app.Spec.RolloutStrategy.Canary.Steps
+	revision := stable.Annotations[shared.AnnotationRevision]
+	template := stable.Spec.Template.DeepCopy()
+	// 开启自动扩缩容时，总副本数以HPA调整后的稳定版本副本数为准，稳定版本的副本数不会被改写，金丝雀副本在此基础上额外增加
+	replicas := totalReplicas(app, live)
+
+	status := app.Status.Rollout
+	if status == nil || status.ActiveColor != "" {
+		// 第一次启用金丝雀发布时，把集群中正在运行的Pod模板当作稳定版本
+		status = &v2.RolloutStatus{StableRevision: revision}
+		if live != nil && live.Annotations[shared.AnnotationRevision] != "" {
+			status.StableRevision = live.Annotations[shared.AnnotationRevision]
+		}
+		app.Status.Rollout = status
+	}
+	// 稳定版本的Deployment还不存在时，直接使用最新的Pod模板创建，不需要发布
+	if live == nil {
+		status.StableRevision = revision
+	}
+
+	action, err := r.takeRolloutAction(ctx, app)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch revision {
+	case status.StableRevision:
+		finishRollout(status, v2.RolloutHealthy, "The stable pod template serves all traffic")
+		return nil, 0, nil
+	case status.AbortedRevision:
+		keepStableTemplate(stable, live, status)
+		finishRollout(status, v2.RolloutAborted, "The rollout was aborted, the stable pod template serves all traffic")
+		return nil, 0, nil
+	}
+
+	// 开始新的发布：如果Pod模板在发布过程中再次发生变化，从第一步重新开始
+	if status.CanaryRevision != revision {
+		log.Info("Starting a canary rollout.", "stableRevision", status.StableRevision, "canaryRevision", revision)
+		status.CanaryRevision = revision
+		status.AbortedRevision = ""
+		status.CurrentStepIndex = 0
+		status.CurrentWeight = 0
+		status.PauseStartTime = nil
+	}
+
+	switch action {
+	case shared.RolloutActionAbort:
+		log.Info("Aborting the canary rollout.", "canaryRevision", revision)
+		status.AbortedRevision = revision
+		keepStableTemplate(stable, live, status)
+		finishRollout(status, v2.RolloutAborted, "The rollout was aborted, the stable pod template serves all traffic")
+		return nil, 0, nil
+	case shared.RolloutActionPromote:
+		status.CurrentStepIndex = int32(len(steps))
+	case shared.RolloutActionResume:
+		if int(status.CurrentStepIndex) < len(steps) && steps[status.CurrentStepIndex].Pause != nil {
+			status.CurrentStepIndex++
+			status.PauseStartTime = nil
+		}
+	}
+
+	canaryLive, err := r.getDeployment(ctx, app, canaryName(app))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 依次执行发布步骤：权重步骤在金丝雀副本全部可用后完成，暂停步骤在到期或者收到resume后完成
+	var requeueAfter time.Duration
+	for int(status.CurrentStepIndex) < len(steps) {
+		step := steps[status.CurrentStepIndex]
+		if step.Pause != nil {
+			if status.PauseStartTime == nil {
+				status.PauseStartTime = &metav1.Time{Time: time.Now()}
+			}
+			status.Phase = v2.RolloutPaused
+			if step.Pause.Duration == nil {
+				status.Message = fmt.Sprintf("Step %d/%d: paused, waiting for the %s action", status.CurrentStepIndex+1, len(steps), shared.RolloutActionResume)
+				break
+			}
+			remaining := time.Until(status.PauseStartTime.Add(step.Pause.Duration.Duration))
+			if remaining > 0 {
+				status.Message = fmt.Sprintf("Step %d/%d: paused for %s", status.CurrentStepIndex+1, len(steps), step.Pause.Duration.Duration)
+				requeueAfter = remaining
+				break
+			}
+			status.CurrentStepIndex++
+			status.PauseStartTime = nil
+			continue
+		}
+
+		if step.SetWeight != nil {
+			status.CurrentWeight = *step.SetWeight
+		}
+		status.Phase = v2.RolloutProgressing
+		status.Message = fmt.Sprintf("Step %d/%d: shifting %d%% of the replicas to the canary", status.CurrentStepIndex+1, len(steps), status.CurrentWeight)
+		if !workloadReady(canaryLive, revision, canaryReplicas(replicas, status.CurrentWeight)) {
+			break
+		}
+		status.CurrentStepIndex++
+	}
+
+	// 所有步骤都已经完成，提升金丝雀版本：稳定版本使用新的Pod模板，金丝雀版本在稳定版本滚动完成后删除
+	if int(status.CurrentStepIndex) >= len(steps) {
+		log.Info("Promoting the canary rollout.", "revision", revision)
+		status.StableRevision = revision
+		finishRollout(status, v2.RolloutHealthy, "The canary has been promoted")
+		return nil, 0, nil
+	}
+
+	// 发布进行中：稳定版本保持原来的Pod模板，按照权重在两个Deployment之间分配副本数
+	canary := canaryReplicas(replicas, status.CurrentWeight)
+	keepStableTemplate(stable, live, status)
+	stable.Spec.Replicas = ptr.To(replicas - canary)
+	return buildCanaryDeployment(app, stable.Spec.Selector, template, revision, canary), requeueAfter, nil
+}
+
+// buildCanaryDeployment 构造金丝雀版本的Deployment：使用最新渲染的Pod模板template，selector在稳定版本的selector上
+// 增加track标签，与稳定版本的Pod区分开。Service根据稳定版本的selector选择Pod，因此两个版本的Pod都会接收流量
+func buildCanaryDeployment(app *v2.Application, stable *metav1.LabelSelector, template *corev1.PodTemplateSpec, revision string, replicas int32) *appsv1.Deployment {
+	dp := &appsv1.Deployment{}
+	dp.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	dp.SetName(canaryName(app))
+	dp.SetNamespace(app.Namespace)
+	dp.SetLabels(mergeLabels(childLabels(app), map[string]string{shared.LabelTrack: trackCanary}))
+	dp.SetAnnotations(map[string]string{shared.AnnotationRevision: revision})
+	dp.Spec = *app.Spec.Workflow.DeploymentSpec.DeepCopy()
+	dp.Spec.Replicas = ptr.To(replicas)
+	dp.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: mergeLabels(stable.MatchLabels, map[string]string{shared.LabelTrack: trackCanary}),
+	}
+	dp.Spec.Template = *template
+	dp.Spec.Template.SetLabels(mergeLabels(template.Labels, map[string]string{shared.LabelTrack: trackCanary}))
+	return dp
+}
+
+// keepStableTemplate 发布进行中或者中止后，稳定版本继续使用集群中现存的Pod模板
+func keepStableTemplate(stable, live *appsv1.Deployment, status *v2.RolloutStatus) {
+	if live == nil {
+		return
+	}
+	stable.Spec.Template = *live.Spec.Template.DeepCopy()
+	stable.Annotations[shared.AnnotationRevision] = status.StableRevision
+}
+
+// finishRollout 结束当前的发布，清理发布过程中的状态
+func finishRollout(status *v2.RolloutStatus, phase v2.RolloutPhase, message string) {
+	status.Phase = phase
+	status.Message = message
+	status.CanaryRevision = ""
+	status.CurrentStepIndex = 0
+	status.CurrentWeight = 0
+	status.PauseStartTime = nil
+}
+
+// canaryReplicas 根据权重计算金丝雀版本的副本数，向上取整，保证权重大于0时至少有一个金丝雀副本
+func canaryReplicas(total, weight int32) int32 {
+	if weight <= 0 || total <= 0 {
+		return 0
+	}
+	canary := (total*weight + 99) / 100
+	if canary > total {
+		canary = total
+	}
+	return canary
+}
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// componentName 返回组件子资源的名称<application>-<component>
+func componentName(app *v2.Application, component string) string {
+	return app.Name + "-" + component
+}
+
+// componentSelectorLabels 返回组件的选择器标签：instance使用组件子资源的名称，
+// 因此Application自身的选择器不会选中组件的Pod，各个组件之间也互不重叠
+func componentSelectorLabels(app *v2.Application, component string) map[string]string {
+	return map[string]string{
+		shared.LabelInstance:       componentName(app, component),
+		shared.LabelApplicationUID: string(app.UID),
+		shared.LabelComponent:      component,
+	}
+}
+
+// reconcileComponents 为spec.components中的每个组件生成Deployment和Service，删除已经移除的组件的子资源，
+// 并在状态中报告每个组件的情况
+func (r *ApplicationReconciler) reconcileComponents(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var result ctrl.Result
+	var statuses []v2.ComponentStatus
+	if len(app.Spec.Components) > 0 {
+		// 所有组件共享spec.config生成的ConfigMap，它们已经在调谐工作负载时生成
+		cfg, err := r.reconcileConfig(ctx, app)
+		if err != nil {
+			log.Error(err, "Failed to reconcile the configuration, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		for i := range app.Spec.Components {
+			component := &app.Spec.Components[i]
+			status, componentResult, err := r.reconcileComponent(ctx, app, component, cfg)
+			if err != nil {
+				log.Error(err, "Failed to reconcile the component.", "component", component.Name)
+				return componentResult, err
+			}
+			result = mergeResult(result, componentResult)
+			statuses = append(statuses, status)
+		}
+	}
+	app.Status.Components = statuses
+
+	if err := r.pruneComponents(ctx, app); err != nil {
+		log.Error(err, "Failed to delete the children of the removed components, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	return result, nil
+}
+
+// reconcileComponent 调谐单个组件的Deployment和Service，返回组件的状态
+func (r *ApplicationReconciler) reconcileComponent(ctx context.Context, app *v2.Application, component *v2.ComponentSpec, cfg *renderedConfig) (v2.ComponentStatus, ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("component", component.Name)
+	status := v2.ComponentStatus{Name: component.Name}
+	name := componentName(app, component.Name)
+
+	// 与主Deployment一样，已经存在的Deployment沿用它当前的selector
+	selector := &metav1.LabelSelector{MatchLabels: componentSelectorLabels(app, component.Name)}
+	live, err := r.getDeployment(ctx, app, name)
+	if err != nil {
+		log.Error(err, "Failed to get Deployment, will requeue after a short time.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if live != nil && live.Spec.Selector != nil {
+		selector = live.Spec.Selector
+	}
+
+	dp := buildComponentDeployment(app, component, selector, cfg)
+	if err := ctrl.SetControllerReference(app, dp, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, dp, func(live client.Object) error {
+		if sel := live.(*appsv1.Deployment).Spec.Selector; sel != nil && len(sel.MatchExpressions) > 0 {
+			return fmt.Errorf("its immutable selector uses matchExpressions")
+		}
+		return nil
+	}); err != nil {
+		log.Error(err, "Failed to check the ownership of the Deployment.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err = r.apply(ctx, app, dp)
+	switch {
+	case err == nil:
+		log.Info("The Deployment of the component has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The Deployment of the component has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, dp); err != nil {
+			log.Error(err, "Failed to get Deployment, will requeue after a short time.")
+			return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	default:
+		log.Error(err, "Failed to apply Deployment, will requeue after a short time.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Deployment", name, conflict)
+	status.Workflow = dp.Status
+	status.Phase = componentPhase(dp.Status, desiredReplicas(component.Workflow.Replicas))
+	result := conflictResult(conflict)
+
+	// 没有声明端口的组件（例如后台worker）不需要Service
+	if len(component.Service.Ports) == 0 {
+		if err := r.deleteService(ctx, app, name); err != nil {
+			log.Error(err, "Failed to delete Service, will requeue after a short time.")
+			return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, "Service", name, "")
+		return status, result, nil
+	}
+
+	svc := buildComponentService(app, component, selector.MatchLabels)
+	if err := ctrl.SetControllerReference(app, svc, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, svc, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the Service.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	conflict = ""
+	err = r.apply(ctx, app, svc)
+	switch {
+	case err == nil:
+		log.Info("The Service of the component has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The Service of the component has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, svc); err != nil {
+			log.Error(err, "Failed to get Service, will requeue after a short time.")
+			return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	default:
+		log.Error(err, "Failed to apply Service, will requeue after a short time.")
+		return status, ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Service", name, conflict)
+	status.Network = svc.Status
+	return status, mergeResult(result, conflictResult(conflict)), nil
+}
+
+// buildComponentDeployment 根据组件的workflow构造期望的Deployment，与主Deployment一样注入配置和ServiceAccount
+func buildComponentDeployment(app *v2.Application, component *v2.ComponentSpec, selector *metav1.LabelSelector, cfg *renderedConfig) *appsv1.Deployment {
+	dp := &appsv1.Deployment{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	dp.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	dp.SetName(componentName(app, component.Name))
+	dp.SetNamespace(app.Namespace)
+	dp.SetLabels(mergeLabels(app.Labels, componentSelectorLabels(app, component.Name)))
+	dp.Spec = *component.Workflow.DeploymentSpec.DeepCopy()
+	dp.Spec.Selector = selector
+	dp.Spec.Template.SetLabels(mergeLabels(component.Workflow.Template.Labels, componentSelectorLabels(app, component.Name), selector.MatchLabels))
+	injectConfig(&dp.Spec.Template, cfg)
+	injectIdentity(app, &dp.Spec.Template)
+	return dp
+}
+
+// buildComponentService 根据组件的service构造期望的Service，使用组件Deployment的selector，只选择该组件的Pod
+func buildComponentService(app *v2.Application, component *v2.ComponentSpec, pods map[string]string) *corev1.Service {
+	svc := &corev1.Service{}
+	svc.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+	svc.SetName(componentName(app, component.Name))
+	svc.SetNamespace(app.Namespace)
+	svc.SetLabels(mergeLabels(app.Labels, componentSelectorLabels(app, component.Name)))
+	svc.SetAnnotations(component.Service.Annotations)
+	svc.Spec = *component.Service.ServiceSpec.DeepCopy()
+	svc.Spec.Selector = pods
+	return svc
+}
+
+// pruneComponents 删除已经从spec.components中移除的组件的Deployment和Service
+func (r *ApplicationReconciler) pruneComponents(ctx context.Context, app *v2.Application) error {
+	log := log.FromContext(ctx)
+
+	names := sets.New[string]()
+	for _, component := range app.Spec.Components {
+		names.Insert(component.Name)
+	}
+
+	opts := []client.ListOption{
+		client.InNamespace(app.Namespace),
+		client.MatchingLabels{shared.LabelApplicationUID: string(app.UID)},
+		client.HasLabels{shared.LabelComponent},
+	}
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments, opts...); err != nil {
+		return err
+	}
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, opts...); err != nil {
+		return err
+	}
+
+	var stale []client.Object
+	for i := range deployments.Items {
+		stale = append(stale, &deployments.Items[i])
+	}
+	for i := range services.Items {
+		stale = append(stale, &services.Items[i])
+	}
+	for _, obj := range stale {
+		component := obj.GetLabels()[shared.LabelComponent]
+		if names.Has(component) || !metav1.IsControlledBy(obj, app) {
+			continue
+		}
+		if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		log.Info("The child of the removed component has been deleted.", "component", component, "name", obj.GetName())
+	}
+	return nil
+}
+
+// observeComponents 在Application被暂停时只读取组件的Deployment和Service的状态
+func (r *ApplicationReconciler) observeComponents(ctx context.Context, app *v2.Application) error {
+	var statuses []v2.ComponentStatus
+	for _, component := range app.Spec.Components {
+		status := v2.ComponentStatus{Name: component.Name}
+		name := componentName(app, component.Name)
+
+		dp, err := r.getDeployment(ctx, app, name)
+		if err != nil {
+			return err
+		}
+		if dp != nil {
+			status.Workflow = dp.Status
+		}
+		status.Phase = componentPhase(status.Workflow, desiredReplicas(component.Workflow.Replicas))
+
+		svc := &corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, svc); err == nil {
+			status.Network = svc.Status
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+	app.Status.Components = statuses
+	return nil
+}
+
+// componentPhase 根据组件Deployment的状态计算组件的phase，判断方式与Application的conditions一致
+func componentPhase(wf appsv1.DeploymentStatus, desired int32) shared.ApplicationPhase {
+	if c := deploymentCondition(wf, appsv1.DeploymentProgressing); c != nil && c.Reason == "ProgressDeadlineExceeded" {
+		return shared.PhaseDegraded
+	}
+	if c := deploymentCondition(wf, appsv1.DeploymentReplicaFailure); c != nil && c.Status == corev1.ConditionTrue {
+		return shared.PhaseDegraded
+	}
+	if wf.UpdatedReplicas != desired || wf.Replicas != desired || wf.AvailableReplicas != desired {
+		return shared.PhaseProgressing
+	}
+	if desired == 0 || deploymentConditionTrue(wf, appsv1.DeploymentAvailable) {
+		return shared.PhaseRunning
+	}
+	return shared.PhasePending
+}
+
+// componentStates 按照状态对组件分类，返回不可用、正在滚动更新和发布失败的组件名称，用于汇总Application的conditions
+func componentStates(app *v2.Application) (unavailable, progressing, degraded []string) {
+	desired := map[string]int32{}
+	for _, component := range app.Spec.Components {
+		desired[component.Name] = desiredReplicas(component.Workflow.Replicas)
+	}
+	for _, status := range app.Status.Components {
+		if desired[status.Name] > 0 && !deploymentConditionTrue(status.Workflow, appsv1.DeploymentAvailable) {
+			unavailable = append(unavailable, status.Name)
+		}
+		switch status.Phase {
+		case shared.PhaseProgressing:
+			progressing = append(progressing, status.Name)
+		case shared.PhaseDegraded:
+			degraded = append(degraded, status.Name)
+		}
+	}
+	return unavailable, progressing, degraded
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// 未设置spec.config.historyLimit时，每种用途保留的旧ConfigMap数量
+	DefaultConfigHistoryLimit = 3
+	// 未设置spec.config.mountPath时配置文件的挂载目录
+	DefaultConfigMountPath = "/etc/config"
+
+	// 生成的ConfigMap上apps.wuyong.cn/config标签的取值
+	configKindFiles = "files"
+	configKindEnv   = "env"
+
+	// 注入到Pod模板中的卷名称，带有前缀以免与用户声明的卷重名
+	configVolumeName       = "app-config"
+	secretVolumeNamePrefix = "app-secret-"
+)
+
+// renderedConfig 是spec.config和spec.secrets渲染的结果，由reconcileConfig生成，buildDeployment据此修改Pod模板
+type renderedConfig struct {
+	// 生成的ConfigMap的名称，没有对应的配置时为空
+	filesName, envName string
+	mountPath          string
+	secrets            []v2.SecretReference
+	// 写入Pod模板注解的校验和，配置或者Secret的内容发生变化时随之变化，从而触发滚动更新
+	checksum string
+}
+
+// buildConfigMaps 根据spec.config构造期望的ConfigMap：文件和环境变量分别生成一个不可变的ConfigMap，
+// 名称中带有内容的哈希值，内容变化时生成新的ConfigMap，而不是修改已有的
+func buildConfigMaps(app *v2.Application) []*corev1.ConfigMap {
+	if app.Spec.Config == nil {
+		return nil
+	}
+	var cms []*corev1.ConfigMap
+	for _, item := range []struct {
+		kind string
+		data map[string]string
+	}{{configKindFiles, app.Spec.Config.Files}, {configKindEnv, app.Spec.Config.Env}} {
+		if len(item.data) == 0 {
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		cm.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		cm.SetName(fmt.Sprintf("%s-%s-%s", app.Name, item.kind, computeHash(item.data)))
+		cm.SetNamespace(app.Namespace)
+		cm.SetLabels(mergeLabels(childLabels(app), map[string]string{shared.LabelConfig: item.kind}))
+		cm.Immutable = ptr.To(true)
+		cm.Data = item.data
+		cms = append(cms, cm)
+	}
+	return cms
+}
+
+// reconcileConfig 提交spec.config生成的ConfigMap，并读取Application引用的ConfigMap和Secret计算校验和。
+// 没有配置也没有引用任何对象时返回nil，Pod模板保持不变
+func (r *ApplicationReconciler) reconcileConfig(ctx context.Context, app *v2.Application) (*renderedConfig, error) {
+	log := log.FromContext(ctx)
+
+	cms := buildConfigMaps(app)
+	configMaps, secrets := configReferences(app)
+	if len(cms) == 0 && configMaps.Len() == 0 && secrets.Len() == 0 {
+		return nil, nil
+	}
+
+	cfg := &renderedConfig{mountPath: DefaultConfigMountPath, secrets: app.Spec.Secrets}
+	if app.Spec.Config != nil && app.Spec.Config.MountPath != "" {
+		cfg.mountPath = app.Spec.Config.MountPath
+	}
+	for _, cm := range cms {
+		if err := ctrl.SetControllerReference(app, cm, r.Scheme); err != nil {
+			return nil, err
+		}
+		if err := r.checkOwnership(ctx, app, cm, nil); err != nil {
+			return nil, err
+		}
+		if err := r.apply(ctx, app, cm); err != nil {
+			return nil, err
+		}
+		if cm.Labels[shared.LabelConfig] == configKindFiles {
+			cfg.filesName = cm.Name
+		} else {
+			cfg.envName = cm.Name
+		}
+		log.Info("The ConfigMap has been applied.", "configMap", cm.Name)
+	}
+
+	// 生成的ConfigMap的名称已经包含了内容的哈希值，引用的对象则需要读取内容，它们变化时同样触发滚动更新。
+	// spec.secrets引用的Secret必须存在，Pod模板中的引用可能是optional的，不存在时不计入校验和。
+	// 缓存中只有ConfigMap和Secret的元数据，每次调谐对每个引用的对象都会向API Server发送一次GET，
+	// 代价与引用的数量成正比；换来的是控制器不必在内存中保存集群里所有Secret的内容
+	required := sets.New[string]()
+	for _, ref := range app.Spec.Secrets {
+		required.Insert(ref.Name)
+	}
+	secretData := map[string]map[string][]byte{}
+	for _, name := range sets.List(secrets) {
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, secret); err != nil {
+			if errors.IsNotFound(err) && !required.Has(name) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get Secret %s: %w", name, err)
+		}
+		secretData[name] = secret.Data
+	}
+	configMapData := map[string]any{}
+	for _, name := range sets.List(configMaps) {
+		cm := &corev1.ConfigMap{}
+		if err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, cm); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get ConfigMap %s: %w", name, err)
+		}
+		configMapData[name] = []any{cm.Data, cm.BinaryData}
+	}
+	cfg.checksum = computeHash(struct {
+		Files, Env string
+		Secrets    map[string]map[string][]byte
+		ConfigMaps map[string]any `json:",omitempty"`
+	}{cfg.filesName, cfg.envName, secretData, configMapData})
+	return cfg, nil
+}
+
+// injectConfig 把生成的ConfigMap和引用的Secret注入到Pod模板的所有容器中，并在Pod模板上记录校验和
+func injectConfig(template *corev1.PodTemplateSpec, cfg *renderedConfig) {
+	if cfg == nil {
+		return
+	}
+	template.SetAnnotations(mergeLabels(template.Annotations, map[string]string{shared.AnnotationConfigChecksum: cfg.checksum}))
+
+	var mounts []corev1.VolumeMount
+	var envFrom []corev1.EnvFromSource
+	if cfg.filesName != "" {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: configVolumeName,
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cfg.filesName},
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: configVolumeName, MountPath: cfg.mountPath, ReadOnly: true})
+	}
+	if cfg.envName != "" {
+		envFrom = append(envFrom, corev1.EnvFromSource{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: cfg.envName}},
+		})
+	}
+	for i, ref := range cfg.secrets {
+		if ref.MountPath == "" {
+			envFrom = append(envFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name}},
+			})
+			continue
+		}
+		name := fmt.Sprintf("%s%d", secretVolumeNamePrefix, i)
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: ref.Name}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: name, MountPath: ref.MountPath, ReadOnly: true})
+	}
+
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		container.VolumeMounts = append(container.VolumeMounts, mounts...)
+		container.EnvFrom = append(container.EnvFrom, envFrom...)
+	}
+}
+
+// pruneConfigMaps 清理旧的ConfigMap：每种用途保留最近的spec.config.historyLimit个，
+// 仍然被工作负载的Pod模板引用的ConfigMap（例如发布过程中稳定版本使用的配置）不会被删除
+func (r *ApplicationReconciler) pruneConfigMaps(ctx context.Context, app *v2.Application, templates ...*corev1.PodTemplateSpec) error {
+	log := log.FromContext(ctx)
+
+	inUse := sets.New[string]()
+	for _, template := range templates {
+		for _, volume := range template.Spec.Volumes {
+			if volume.ConfigMap != nil {
+				inUse.Insert(volume.ConfigMap.Name)
+			}
+		}
+		for _, container := range template.Spec.Containers {
+			for _, source := range container.EnvFrom {
+				if source.ConfigMapRef != nil {
+					inUse.Insert(source.ConfigMapRef.Name)
+				}
+			}
+		}
+	}
+	for _, cm := range buildConfigMaps(app) {
+		inUse.Insert(cm.Name)
+	}
+
+	limit := DefaultConfigHistoryLimit
+	if app.Spec.Config != nil && app.Spec.Config.HistoryLimit != nil {
+		limit = int(*app.Spec.Config.HistoryLimit)
+	}
+
+	// 只需要ConfigMap的元数据，从Owns建立的元数据缓存中读取，不会访问API Server
+	list := &metav1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMapList"))
+	if err := r.List(ctx, list, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app)), client.HasLabels{shared.LabelConfig}); err != nil {
+		return err
+	}
+	old := map[string][]*metav1.PartialObjectMetadata{}
+	for i := range list.Items {
+		cm := &list.Items[i]
+		if !metav1.IsControlledBy(cm, app) || inUse.Has(cm.Name) {
+			continue
+		}
+		kind := cm.Labels[shared.LabelConfig]
+		old[kind] = append(old[kind], cm)
+	}
+	for _, cms := range old {
+		// 按照创建时间从新到旧排序，超出保留数量的ConfigMap被删除
+		sort.Slice(cms, func(i, j int) bool {
+			return cms[j].CreationTimestamp.Before(&cms[i].CreationTimestamp)
+		})
+		for i := limit; i < len(cms); i++ {
+			if err := r.Delete(ctx, cms[i]); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			log.Info("The old ConfigMap has been deleted.", "configMap", cms[i].Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// dependencyIndex 是Application上的字段索引，索引值为spec.dependsOn中引用的Application，格式为<namespace>/<name>，
+// 被依赖的Application可用性变化时据此找到等待它的Application
+const dependencyIndex = ".spec.dependsOn"
+
+// dependencyKeys 计算Application在dependencyIndex中的索引值
+func dependencyKeys(obj client.Object) []string {
+	app, ok := obj.(*v2.Application)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(app.Spec.DependsOn))
+	for _, ref := range app.Spec.DependsOn {
+		keys = append(keys, dependencyKey(app, ref).String())
+	}
+	return keys
+}
+
+// dependencyKey 返回被依赖的Application的NamespacedName，命名空间默认与当前Application相同
+func dependencyKey(app *v2.Application, ref v2.ApplicationReference) types.NamespacedName {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = app.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}
+}
+
+// applicationsDependingOn 把Application的可用性变化映射到在spec.dependsOn中引用了它的Application
+func (r *ApplicationReconciler) applicationsDependingOn(ctx context.Context, obj client.Object) []ctrl.Request {
+	list := &v2.ApplicationList{}
+	if err := r.List(ctx, list, client.MatchingFields{dependencyIndex: obj.GetNamespace() + "/" + obj.GetName()}); err != nil {
+		ctrl.Log.WithName("Setup").Error(err, "Failed to list the Applications depending on the Application.", "name", obj.GetName())
+		return nil
+	}
+	requests := make([]ctrl.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
+
+// availabilityChangedPredicate 只在Application的可用性发生变化，或者Application被创建、删除时触发
+func availabilityChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldApp, ok := e.ObjectOld.(*v2.Application)
+			if !ok {
+				return false
+			}
+			newApp, ok := e.ObjectNew.(*v2.Application)
+			if !ok {
+				return false
+			}
+			return dependencyAvailable(oldApp) != dependencyAvailable(newApp)
+		},
+	}
+}
+
+// dependencyAvailable 判断被依赖的Application是否可用：状态必须已经反映最新的spec，并且Available condition为True
+func dependencyAvailable(dep *v2.Application) bool {
+	return dep.DeletionTimestamp.IsZero() &&
+		dep.Status.ObservedGeneration == dep.Generation &&
+		meta.IsStatusConditionTrue(dep.Status.Conditions, shared.ConditionAvailable)
+}
+
+// waitForDependencies 检查spec.dependsOn中的Application是否都已经可用，返回尚未可用的Application，
+// 并据此设置WaitingForDependencies condition
+func (r *ApplicationReconciler) waitForDependencies(ctx context.Context, app *v2.Application) ([]string, error) {
+	if len(app.Spec.DependsOn) == 0 {
+		meta.RemoveStatusCondition(&app.Status.Conditions, shared.ConditionWaitingForDependencies)
+		return nil, nil
+	}
+
+	var blockers []string
+	for _, ref := range app.Spec.DependsOn {
+		key := dependencyKey(app, ref)
+		dep := &v2.Application{}
+		if err := r.Get(ctx, key, dep); err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, err
+			}
+			blockers = append(blockers, key.String()+" (not found)")
+			continue
+		}
+		if !dependencyAvailable(dep) {
+			blockers = append(blockers, key.String())
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               shared.ConditionWaitingForDependencies,
+		Status:             metav1.ConditionFalse,
+		Reason:             shared.ReasonDependenciesAvailable,
+		Message:            "All dependencies are Available",
+		ObservedGeneration: app.Generation,
+	}
+	if len(blockers) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = shared.ReasonDependenciesNotAvailable
+		condition.Message = "Waiting for " + strings.Join(blockers, ", ")
+	}
+	meta.SetStatusCondition(&app.Status.Conditions, condition)
+	return blockers, nil
+}
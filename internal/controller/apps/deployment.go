@@ -2,76 +2,188 @@ package controller
 
 import (
 	"context"
-	"reflect"
+	"fmt"
 
 	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 func (r *ApplicationReconciler) reconcileDeployment(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
-	// 先根据Application中的Namespace和Name信息查询对应的Deployment是否存在
-	var dp = &appsv1.Deployment{}
-	// types.NamespaceedName用于唯一标识Kubernetes集群中的资源,dp是一个指针，如果Get方法成功执行，这个指针指向从API服务器中获取的Deployment对象
-	err := r.Get(ctx, types.NamespacedName{
-		Namespace: app.Namespace,
-		Name:      app.Name,
-	}, dp)
-
-	// 没有错误发生时，更新状态
-	if err == nil {
-		log.Info("The Deployment has already exist.")
-		// 使用reflect.DeepEqual比较Deployment的状态(dp.Status)与Application自定义资源的工作流状态(app.Status.Workflow)是否完全相同
-		// 如果相同，说明没有变化，不需要进一步处理
-		if reflect.DeepEqual(dp.Status, app.Status.Workflow) {
-			return ctrl.Result{}, nil
-		}
-
-		// 如果不同，需要更新Application的状态
-		app.Status.Workflow = dp.Status
-		// 调用r.Status().Update更新Application资源的状态
-		if err := r.Status().Update(ctx, app); err != nil {
-			log.Error(err, "Failed to update Application status")
-			// 返回一个带有重新排队时间的结果和错误，表示需要在一段时间后重试
-			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
-		}
-		log.Info("The Application status has been updated.")
-		return ctrl.Result{}, nil
+	// 从其他类型切换回Deployment时，删除之前生成的StatefulSet、Job等工作负载
+	if err := r.deleteOtherWorkloads(ctx, app); err != nil {
+		log.Error(err, "Failed to delete the previous workloads, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	// 如果不是NotFound的错误，即发生了其他错误，结束本轮调谐，一段时间后重试
-	if !errors.IsNotFound(err) {
+	// Deployment的selector是不可变的：已经存在的Deployment沿用它当前的selector，
+	// 新建时使用控制器生成的选择器标签，这样修改Application的标签不会破坏selector
+	selector := &metav1.LabelSelector{MatchLabels: selectorLabels(app)}
+	live := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, live); err == nil {
+		if live.Spec.Selector != nil {
+			selector = live.Spec.Selector
+		}
+	} else if errors.IsNotFound(err) {
+		live = nil
+	} else {
 		log.Error(err, "Failed to get Deployment, will requeue after a short time.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	// 根据Application资源实例信息来构造Deployment实例
-	newDp := &appsv1.Deployment{}
-	newDp.SetName(app.Name)
-	newDp.SetNamespace(app.Namespace)
-	newDp.SetLabels(app.Labels)
-	newDp.Spec = app.Spec.Workflow.DeploymentSpec
-	// 这是Pod的模板，Pod模板的Labels是独立的，必须单独设置，如果不设置，回到是Deployment的selector无法匹配到Pod
-	newDp.Spec.Template.SetLabels(app.Labels)
+	// 生成spec.config对应的ConfigMap，并读取spec.secrets引用的Secret，计算需要写入Pod模板的校验和
+	cfg, err := r.reconcileConfig(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile the configuration, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
 
+	// 根据Application计算出期望的Deployment
+	dp := r.buildDeployment(app, selector, cfg)
 	// 用于建立App里擦同与Deployment之间的父子关系：Kubernetes通过owner Reference实现级联删除，当Application被删除时，Kubernetes
 	// 会自动删除它创建的Deployment; r.scheme用来识别资源类型的Scheme，确保类型正确
-	if err := ctrl.SetControllerReference(app, newDp, r.Scheme); err != nil {
+	if err := ctrl.SetControllerReference(app, dp, r.Scheme); err != nil {
 		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	// 在集群中创建Deployment：调用客户端的Create方法，将newDp提交到Kubernetes API Server
-	if err := r.Create(ctx, newDp); err != nil {
-		log.Error(err, "Failed to create Deployment, will requeue, after a short time.")
+	// 同名的Deployment已经存在但不属于当前Application时，只有在允许接管并且selector兼容时才继续。
+	// 接管后沿用它原来的selector，控制器只能通过Pod模板标签满足matchLabels，无法满足matchExpressions
+	if err := r.checkOwnership(ctx, app, dp, func(live client.Object) error {
+		if sel := live.(*appsv1.Deployment).Spec.Selector; sel != nil && len(sel.MatchExpressions) > 0 {
+			return fmt.Errorf("its immutable selector uses matchExpressions")
+		}
+		return nil
+	}); err != nil {
+		log.Error(err, "Failed to check the ownership of the Deployment.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	// 配置了发布策略时，新的Pod模板先发布到第二个Deployment：金丝雀发布按照步骤调整两个版本的副本数，
+	// 蓝绿发布在两个颜色之间切换主Service
+	var canary, green *appsv1.Deployment
+	var result ctrl.Result
+	switch {
+	case canaryEnabled(app):
+		canary, result.RequeueAfter, err = r.planCanary(ctx, app, dp, live)
+	case blueGreenEnabled(app):
+		green, result.RequeueAfter, err = r.planBlueGreen(ctx, app, dp, live)
+	default:
+		app.Status.Rollout = nil
+	}
+	if err != nil {
+		log.Error(err, "Failed to plan the rollout, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	// 开启自动扩缩容时，副本数交给HPA管理，控制器不再提交spec.replicas；关闭后需要先从HPA手中收回这个字段
+	var reclaimed bool
+	if autoscalingEnabled(app) {
+		if err := r.releaseReplicas(ctx, dp, live); err != nil {
+			log.Error(err, "Failed to hand the replicas over to the autoscaler, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	} else if reclaimed, err = r.reclaimReplicas(ctx, dp, live); err != nil {
+		log.Error(err, "Failed to take the replicas back from the autoscaler, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	// 通过Server-Side Apply提交期望的Deployment：不存在时创建，存在时只更新控制器拥有的字段，
+	// 这样Application的修改能够滚动到集群中，其他manager拥有的字段（例如HPA管理的replicas）不会被覆盖
+	var conflict string
+	err = r.apply(ctx, app, dp)
+	switch {
+	case err == nil:
+		log.Info("The Deployment has been applied.")
+		if reclaimed {
+			if err := r.releaseHandover(ctx, dp); err != nil {
+				log.Error(err, "Failed to release the replicas taken back from the autoscaler, will requeue after a short time.")
+				return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+			}
+		}
+	case errors.IsConflict(err):
+		// 字段冲突不会被静默覆盖，而是记录到Application状态中，此时需要重新获取Deployment来同步状态
+		log.Info("The Deployment has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, dp); err != nil {
+			log.Error(err, "Failed to get Deployment, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	default:
+		log.Error(err, "Failed to apply Deployment, will requeue after a short time.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	log.Info("The Deployment has been created.")
-	return ctrl.Result{}, nil
+	// 将Deployment的状态同步到Application中，由Reconcile统一计算conditions并更新Application状态
+	setFieldConflict(app, "Deployment", dp.Name, conflict)
+	app.Status.Workflow = dp.Status
+
+	result = mergeResult(result, conflictResult(conflict))
+	for _, secondary := range []struct {
+		name    string
+		desired *appsv1.Deployment
+	}{{canaryName(app), canary}, {greenName(app), green}} {
+		secondaryResult, err := r.reconcileSecondaryDeployment(ctx, app, secondary.name, dp, secondary.desired)
+		if err != nil {
+			return secondaryResult, err
+		}
+		result = mergeResult(result, secondaryResult)
+	}
+	// 蓝绿发布时，Application的状态反映主Service当前选中的Deployment
+	if activeColor(app) == shared.ColorGreen && green != nil {
+		app.Status.Workflow = green.Status
+	}
+
+	// 所有Deployment都已经提交，清理不再被引用的旧ConfigMap
+	templates := []*corev1.PodTemplateSpec{&dp.Spec.Template}
+	for _, secondary := range []*appsv1.Deployment{canary, green} {
+		if secondary != nil {
+			templates = append(templates, &secondary.Spec.Template)
+		}
+	}
+	if err := r.pruneConfigMaps(ctx, app, templates...); err != nil {
+		log.Error(err, "Failed to prune the old ConfigMaps, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	return result, nil
+}
+
+// buildDeployment 根据Application资源实例信息来构造期望的Deployment实例
+func (r *ApplicationReconciler) buildDeployment(app *v2.Application, selector *metav1.LabelSelector, cfg *renderedConfig) *appsv1.Deployment {
+	dp := &appsv1.Deployment{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	dp.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	dp.SetName(app.Name)
+	dp.SetNamespace(app.Namespace)
+	dp.SetLabels(childLabels(app))
+	dp.Spec = *app.Spec.Workflow.DeploymentSpec.DeepCopy()
+	// spec.workflow.selector会被忽略，selector由控制器决定
+	dp.Spec.Selector = selector
+	// 这是Pod的模板，Pod模板的Labels是独立的，必须单独设置：在用户声明的模板标签基础上合并selector要求的标签，
+	// 而不是直接替换，如果不设置，会导致Deployment的selector无法匹配到Pod
+	dp.Spec.Template.SetLabels(podTemplateLabels(app, selector))
+	// 注入生成的配置和引用的Secret，配置的变化会改变Pod模板，从而触发滚动更新
+	injectConfig(&dp.Spec.Template, cfg)
+	// 使用spec.identity声明的ServiceAccount运行Pod
+	injectIdentity(app, &dp.Spec.Template)
+	// 记录渲染出来的Pod模板的哈希值，用于在发布过程中区分新旧两个版本
+	dp.SetAnnotations(map[string]string{shared.AnnotationRevision: computeHash(dp.Spec.Template)})
+	return dp
+}
+
+// desiredReplicas 返回期望的副本数，未设置时与Deployment的默认值保持一致
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
 }
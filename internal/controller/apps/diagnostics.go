@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// maxPodFailures 限制status.podFailures的条目数，大量Pod同时失败时状态也不会过大
+	maxPodFailures = 10
+	// maxFailureMessageLength 容器的终止消息最长可达4KB，状态中只保留开头的部分
+	maxFailureMessageLength = 256
+)
+
+// applicationUIDIndex 是Application上的字段索引，索引值为Application的UID。
+// Pod上只有apps.wuyong.cn/application-uid标签能够可靠地对应到Application，据此找到Pod所属的Application
+const applicationUIDIndex = ".metadata.uid"
+
+// applicationUIDKeys 计算Application在applicationUIDIndex中的索引值
+func applicationUIDKeys(obj client.Object) []string {
+	return []string{string(obj.GetUID())}
+}
+
+// applicationForPod 把Pod的变化映射到它所属的Application，组件的Pod同样带有Application的UID标签。
+// 接管的工作负载的Pod带有之前的Application的UID，找不到对应的Application时根据status.selector查找
+func (r *ApplicationReconciler) applicationForPod(ctx context.Context, obj client.Object) []ctrl.Request {
+	uid := obj.GetLabels()[shared.LabelApplicationUID]
+	if uid == "" {
+		return nil
+	}
+	list := &v2.ApplicationList{}
+	if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{applicationUIDIndex: uid}); err != nil {
+		ctrl.Log.WithName("Setup").Error(err, "Failed to list the Application of the Pod.", "name", obj.GetName())
+		return nil
+	}
+	if len(list.Items) == 0 {
+		if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+			ctrl.Log.WithName("Setup").Error(err, "Failed to list the Applications of the namespace.", "name", obj.GetName())
+			return nil
+		}
+		list.Items = slices.DeleteFunc(list.Items, func(app v2.Application) bool {
+			selector, err := labels.Parse(app.Status.Selector)
+			return app.Status.Selector == "" || err != nil || !selector.Matches(labels.Set(obj.GetLabels()))
+		})
+	}
+	requests := make([]ctrl.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
+
+// podFailuresChangedPredicate 只在Pod的失败原因发生变化，或者失败的Pod被删除时触发。
+// 正常Pod的创建和就绪由Deployment的状态变化触发调谐，不需要再监听
+func podFailuresChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			pod, ok := e.Object.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			failures, _ := podFailures(pod, time.Now())
+			return len(failures) > 0
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPod, ok := e.ObjectOld.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			newPod, ok := e.ObjectNew.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			now := time.Now()
+			oldFailures, _ := podFailures(oldPod, now)
+			newFailures, _ := podFailures(newPod, now)
+			return !reflect.DeepEqual(oldFailures, newFailures)
+		},
+	}
+}
+
+// observePods 检查Application和组件的所有Pod，把失败原因去重后写入status.podFailures，
+// 并把podSelector写入scale子资源读取的status.selector，统计它选中的Pod数量作为副本数。
+// 就绪探针失败需要持续一段时间才会报告，返回的ctrl.Result要求在那时重新检查
+func (r *ApplicationReconciler) observePods(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	podSelector, err := r.podSelector(ctx, app)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	// 自动扩缩容器据此找到Application的Pod
+	selector := labels.SelectorFromSet(podSelector)
+	app.Status.Selector = selector.String()
+
+	// 接管的工作负载的Pod带有之前的Application的UID，同样需要检查
+	all := &corev1.PodList{}
+	if err := r.List(ctx, all, client.InNamespace(app.Namespace), client.HasLabels{shared.LabelApplicationUID}); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	pods := &corev1.PodList{}
+	for i := range all.Items {
+		if all.Items[i].Labels[shared.LabelApplicationUID] == string(app.UID) || selector.Matches(labels.Set(all.Items[i].Labels)) {
+			pods.Items = append(pods.Items, all.Items[i])
+		}
+	}
+	// 按名称排序，保证每个失败原因记录的示例Pod和消息是稳定的，不会导致状态反复更新
+	slices.SortFunc(pods.Items, func(a, b corev1.Pod) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	type failureKey struct {
+		component, container string
+		reason               v2.PodFailureReason
+	}
+	var requeue ctrl.Result
+	var failures []v2.PodFailure
+	seen := map[failureKey]int{}
+	now := time.Now()
+	// 与status.selector使用同一个选择器统计副本数：金丝雀和蓝绿发布的第二个Deployment的Pod同样被选中，也需要计入，
+	// 否则自动扩缩容器会用全部Pod的指标除以只包含主工作负载的副本数。正在删除和已经结束的Pod不计入
+	var replicas int32
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if selector.Matches(labels.Set(pod.Labels)) && pod.DeletionTimestamp.IsZero() &&
+			pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			replicas++
+		}
+	}
+	app.Status.Replicas = replicas
+
+	for i := range pods.Items {
+		found, recheck := podFailures(&pods.Items[i], now)
+		requeue = mergeResult(requeue, ctrl.Result{RequeueAfter: recheck})
+		for _, f := range found {
+			key := failureKey{component: f.Component, container: f.Container, reason: f.Reason}
+			if j, ok := seen[key]; ok {
+				failures[j].Pods++
+				failures[j].RestartCount = max(failures[j].RestartCount, f.RestartCount)
+				continue
+			}
+			seen[key] = len(failures)
+			failures = append(failures, f)
+		}
+	}
+
+	slices.SortFunc(failures, func(a, b v2.PodFailure) int {
+		return cmp.Or(
+			cmp.Compare(a.Component, b.Component),
+			cmp.Compare(a.Container, b.Container),
+			cmp.Compare(a.Reason, b.Reason),
+		)
+	})
+	if len(failures) > maxPodFailures {
+		failures = failures[:maxPodFailures]
+	}
+	app.Status.PodFailures = failures
+	return requeue, nil
+}
+
+// podFailures 找出一个Pod的失败原因，每个容器最多报告一个。
+// 就绪探针失败的时间还没有超过探针允许的范围时不报告，返回的time.Duration表示还需要多久才会超过
+func podFailures(pod *corev1.Pod, now time.Time) ([]v2.PodFailure, time.Duration) {
+	if !pod.DeletionTimestamp.IsZero() || pod.Status.Phase == corev1.PodSucceeded {
+		return nil, 0
+	}
+	newFailure := func(reason v2.PodFailureReason, container string, restarts int32, message string) v2.PodFailure {
+		return v2.PodFailure{
+			Reason:       reason,
+			Component:    pod.Labels[shared.LabelComponent],
+			Container:    container,
+			Pod:          pod.Name,
+			Pods:         1,
+			RestartCount: restarts,
+			Message:      truncateMessage(message),
+		}
+	}
+
+	var failures []v2.PodFailure
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			failures = append(failures, newFailure(v2.PodFailureUnschedulable, "", 0, c.Message))
+		}
+	}
+
+	// 记录声明了就绪探针的容器，包括以sidecar方式运行的init容器
+	probes := map[string]*corev1.Probe{}
+	for _, c := range append(slices.Clone(pod.Spec.InitContainers), pod.Spec.Containers...) {
+		if c.ReadinessProbe != nil {
+			probes[c.Name] = c.ReadinessProbe
+		}
+	}
+	// Pod的Ready condition变为False的时间，容器曾经就绪过时从这个时间开始计算就绪探针失败的时长
+	var notReadySince time.Time
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionFalse {
+			notReadySince = c.LastTransitionTime.Time
+		}
+	}
+
+	var recheck time.Duration
+	for _, cs := range append(slices.Clone(pod.Status.InitContainerStatuses), pod.Status.ContainerStatuses...) {
+		last := cs.LastTerminationState.Terminated
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.Reason == "OOMKilled":
+			failures = append(failures, newFailure(v2.PodFailureOOMKilled, cs.Name, cs.RestartCount, terminationMessage(cs.State.Terminated)))
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff":
+			reason, message := v2.PodFailureCrashLoopBackOff, cs.State.Waiting.Message
+			if last != nil {
+				message = terminationMessage(last)
+				if last.Reason == "OOMKilled" {
+					reason = v2.PodFailureOOMKilled
+				}
+			}
+			failures = append(failures, newFailure(reason, cs.Name, cs.RestartCount, message))
+		case cs.State.Waiting != nil && imagePullFailed(cs.State.Waiting.Reason):
+			failures = append(failures, newFailure(v2.PodFailureImagePullBackOff, cs.Name, cs.RestartCount, cs.State.Waiting.Message))
+		case cs.State.Running != nil && !cs.Ready && probes[cs.Name] != nil:
+			// 启动探针尚未通过时，就绪探针还没有开始执行
+			if cs.Started != nil && !*cs.Started {
+				continue
+			}
+			since := cs.State.Running.StartedAt.Time
+			if notReadySince.After(since) {
+				since = notReadySince
+			}
+			if remaining := probeTolerance(probes[cs.Name]) - now.Sub(since); remaining > 0 {
+				if recheck == 0 || remaining < recheck {
+					recheck = remaining
+				}
+				continue
+			}
+			failures = append(failures, newFailure(v2.PodFailureProbeFailed, cs.Name, cs.RestartCount,
+				fmt.Sprintf("The readiness probe has been failing since %s", since.UTC().Format(time.RFC3339))))
+		}
+	}
+	return failures, recheck
+}
+
+// imagePullFailed 判断容器是否因为无法拉取镜像而处于等待状态
+func imagePullFailed(reason string) bool {
+	switch reason {
+	case "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "ErrImageNeverPull":
+		return true
+	}
+	return false
+}
+
+// probeTolerance 返回探针从开始执行到判定失败所需的时间，未设置的字段使用Kubernetes的默认值
+func probeTolerance(probe *corev1.Probe) time.Duration {
+	period := probe.PeriodSeconds
+	if period == 0 {
+		period = 10
+	}
+	threshold := probe.FailureThreshold
+	if threshold == 0 {
+		threshold = 3
+	}
+	return time.Duration(probe.InitialDelaySeconds+period*threshold) * time.Second
+}
+
+// terminationMessage 描述容器最近一次终止的原因、退出码以及容器写入的终止消息
+func terminationMessage(t *corev1.ContainerStateTerminated) string {
+	message := fmt.Sprintf("Terminated with %s (exit code %d)", t.Reason, t.ExitCode)
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		message += ": " + msg
+	}
+	return message
+}
+
+// truncateMessage 截断过长的消息，并保证截断后仍然是合法的UTF-8字符串
+func truncateMessage(message string) string {
+	if len(message) <= maxFailureMessageLength {
+		return message
+	}
+	return strings.ToValidUTF8(message[:maxFailureMessageLength], "") + "..."
+}
+
+// podFailuresMessage 把status.podFailures汇总为Degraded condition的消息
+func podFailuresMessage(failures []v2.PodFailure) string {
+	parts := make([]string, 0, len(failures))
+	for _, f := range failures {
+		where := "pod " + f.Pod
+		if f.Container != "" {
+			where = "container " + f.Container + " of " + where
+		}
+		part := fmt.Sprintf("%s in %s", f.Reason, where)
+		if f.Pods > 1 {
+			part += fmt.Sprintf(" and %d other pod(s)", f.Pods-1)
+		}
+		if f.Message != "" {
+			part += ": " + f.Message
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// 等待子资源被删除时的重新排队时间间隔
+const CleanupRequeueDuration = 5 * time.Second
+
+// childObjects 返回Application生成的所有子资源，只填充了Namespace和Name，用于清理时逐个查询。
+// 新增子资源类型时需要在这里登记，否则deletionPolicy不会作用到它上面
+func childObjects(app *v2.Application) []client.Object {
+	objMeta := metav1.ObjectMeta{Namespace: app.Namespace, Name: app.Name}
+	children := []client.Object{
+		&appsv1.Deployment{ObjectMeta: objMeta},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: canaryName(app)}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: greenName(app)}},
+		&appsv1.StatefulSet{ObjectMeta: objMeta},
+		&batchv1.CronJob{ObjectMeta: objMeta},
+		&corev1.Service{ObjectMeta: objMeta},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: app.Name + "-headless"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: previewServiceName(app)}},
+		&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: objMeta},
+		&policyv1.PodDisruptionBudget{ObjectMeta: objMeta},
+		&networkingv1.Ingress{ObjectMeta: objMeta},
+		&networkingv1.NetworkPolicy{ObjectMeta: objMeta},
+	}
+	for _, component := range app.Spec.Components {
+		name := componentName(app, component.Name)
+		children = append(children,
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: name}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: name}},
+		)
+	}
+	// Job的名称带有模板的哈希值，只能从状态中找到
+	if batch := app.Status.Batch; batch != nil {
+		for _, name := range batch.Active {
+			children = append(children, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: name}})
+		}
+		if batch.FinishedJob != "" {
+			children = append(children, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: batch.FinishedJob}})
+		}
+	}
+	if createsServiceAccount(app) {
+		children = append(children, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: serviceAccountName(app)}})
+	}
+	if app.Spec.Identity != nil {
+		for _, role := range app.Spec.Identity.Roles {
+			children = append(children, &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: roleBindingName(app, role)}})
+		}
+	}
+	// ConfigMap只以元数据的形式缓存，清理时也只需要元数据
+	for _, cm := range buildConfigMaps(app) {
+		obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: cm.Name}}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		children = append(children, obj)
+	}
+	for _, route := range app.Spec.Routes {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(HTTPRouteGVK)
+		obj.SetNamespace(app.Namespace)
+		obj.SetName(routeName(app, route))
+		children = append(children, obj)
+	}
+	return children
+}
+
+// finalize 在Application被删除时根据spec.deletionPolicy处理子资源，处理完成后移除finalizer：
+//   - Delete：显式删除子资源，并等待它们全部消失，期间在状态中报告清理进度
+//   - Orphan：移除子资源上指向Application的owner reference，子资源继续运行但不再被管理
+//   - Retain：与Orphan相同，并在子资源上标记apps.wuyong.cn/retained-from注解
+func (r *ApplicationReconciler) finalize(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(app, shared.CleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	policy := app.Spec.DeletionPolicy
+	if policy == "" {
+		policy = shared.DeletionPolicyDelete
+	}
+
+	var pending []string
+	for _, child := range childObjects(app) {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(child), child); err != nil {
+			// 没有安装CRD的子资源类型（例如HTTPRoute）不可能存在，直接跳过
+			if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			log.Error(err, "Failed to get child resource, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		// 只处理由当前Application控制的子资源，同名但不属于它的资源不做任何改动
+		if !metav1.IsControlledBy(child, app) {
+			continue
+		}
+		gvk, err := apiutil.GVKForObject(child, r.Scheme)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		childName := gvk.Kind + "/" + child.GetName()
+
+		switch policy {
+		case shared.DeletionPolicyOrphan, shared.DeletionPolicyRetain:
+			if err := r.releaseChild(ctx, app, child, policy); err != nil {
+				log.Error(err, "Failed to release child resource, will requeue after a short time.", "child", childName)
+				return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+			}
+			log.Info("The child resource has been released.", "child", childName, "policy", policy)
+		default:
+			if child.GetDeletionTimestamp().IsZero() {
+				err := r.Delete(ctx, child, client.PropagationPolicy(metav1.DeletePropagationBackground))
+				if err != nil && !errors.IsNotFound(err) {
+					log.Error(err, "Failed to delete child resource, will requeue after a short time.", "child", childName)
+					return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+				}
+			}
+			pending = append(pending, childName)
+		}
+	}
+
+	// 还有子资源没有删除完成时，在状态中报告清理进度，稍后再检查
+	if len(pending) > 0 {
+		original := app.Status.DeepCopy()
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               shared.ConditionCleanup,
+			Status:             metav1.ConditionTrue,
+			Reason:             shared.ReasonWaitingForChildren,
+			Message:            fmt.Sprintf("Waiting for %s to be deleted", strings.Join(pending, ", ")),
+			ObservedGeneration: app.Generation,
+		})
+		app.Status.Phase = shared.PhaseTerminating
+		if !equality.Semantic.DeepEqual(original, &app.Status) {
+			if err := r.Status().Update(ctx, app); err != nil {
+				log.Error(err, "Failed to update Application status, will requeue after a short time.")
+				return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+			}
+		}
+		log.Info("Waiting for the children to be deleted.", "pending", pending)
+		return ctrl.Result{RequeueAfter: CleanupRequeueDuration}, nil
+	}
+
+	// 子资源已经处理完毕，移除finalizer，Application随后会被API Server真正删除
+	controllerutil.RemoveFinalizer(app, shared.CleanupFinalizer)
+	if err := r.Update(ctx, app); err != nil {
+		log.Error(err, "Failed to remove finalizer, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	log.Info("The cleanup finalizer has been removed.", "policy", policy)
+	return ctrl.Result{}, nil
+}
+
+// releaseChild 移除子资源上指向Application的owner reference，使垃圾回收器不再删除它。
+// 工作负载不可变的selector中仍然带有当前Application的UID，同名Application重新创建并接管后，
+// 所有选择Pod的地方都通过podSelector沿用这个selector
+func (r *ApplicationReconciler) releaseChild(ctx context.Context, app *v2.Application, child client.Object, policy shared.DeletionPolicy) error {
+	patch := client.MergeFromWithOptions(child.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+
+	var refs []metav1.OwnerReference
+	for _, ref := range child.GetOwnerReferences() {
+		if ref.UID != app.UID {
+			refs = append(refs, ref)
+		}
+	}
+	child.SetOwnerReferences(refs)
+
+	if policy == shared.DeletionPolicyRetain {
+		annotations := child.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[shared.AnnotationRetainedFrom] = app.Namespace + "/" + app.Name
+		child.SetAnnotations(annotations)
+	}
+
+	return r.Patch(ctx, child, patch)
+}
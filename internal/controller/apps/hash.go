@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// computeHash 计算对象的哈希值，用于判断Pod模板等渲染结果是否发生了变化，
+// 与Deployment控制器计算pod-template-hash的方式类似
+func computeHash(obj any) string {
+	hasher := fnv.New32a()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		// 渲染出来的对象一定可以序列化，这里只是兜底
+		data = []byte(fmt.Sprintf("%#v", obj))
+	}
+	_, _ = hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// 未设置spec.revisionHistoryLimit时保留的历史revision数量
+const DefaultRevisionHistoryLimit = 10
+
+// revisionSpec 是保存在ControllerRevision中的渲染输入，回滚时会被写回Application的spec。
+// 与Deployment自身的滚动历史不同，它同时包含Service，并且不会因为Deployment被删除而丢失
+type revisionSpec struct {
+	Workflow shared.DeploymentTemplate `json:"workflow"`
+	Service  shared.ServiceTemplate    `json:"service"`
+	// 没有组件时不写入，保持之前记录的revision的哈希值不变
+	Components []v2.ComponentSpec `json:"components,omitempty"`
+}
+
+// RollbackFailedError 表示apps.wuyong.cn/rollback-to注解指定的revision无法回滚，需要用户修正或者移除注解
+type RollbackFailedError struct {
+	Reason string
+}
+
+func (e *RollbackFailedError) Error() string {
+	return "rollback failed: " + e.Reason
+}
+
+func newRevisionSpec(app *v2.Application) revisionSpec {
+	return revisionSpec{Workflow: app.Spec.Workflow, Service: app.Spec.Service, Components: app.Spec.Components}
+}
+
+// listRevisions 返回由Application控制的ControllerRevision，按照revision从小到大排序
+func (r *ApplicationReconciler) listRevisions(ctx context.Context, app *v2.Application) ([]*appsv1.ControllerRevision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	if err := r.List(ctx, list, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app))); err != nil {
+		return nil, err
+	}
+	var revisions []*appsv1.ControllerRevision
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], app) {
+			revisions = append(revisions, &list.Items[i])
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// reconcileHistory 把当前spec的渲染输入记录为ControllerRevision，并清理超出spec.revisionHistoryLimit的旧revision。
+// 恢复到历史上出现过的spec时不会创建新的revision，而是把已有的revision重新编号为最新的。
+// ControllerRevision由Application控制，Application被删除后由垃圾回收器清理，不受deletionPolicy影响
+func (r *ApplicationReconciler) reconcileHistory(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	spec := newRevisionSpec(app)
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	name := app.Name + "-" + computeHash(spec)
+
+	revisions, err := r.listRevisions(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to list ControllerRevisions, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	var current *appsv1.ControllerRevision
+	var latest int64
+	for _, revision := range revisions {
+		if revision.Name == name {
+			current = revision
+		}
+		latest = max(latest, revision.Revision)
+	}
+
+	switch {
+	case current == nil:
+		current = &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: app.Namespace, Labels: selectorLabels(app)},
+			Data:       runtime.RawExtension{Raw: data},
+			Revision:   latest + 1,
+		}
+		if err := ctrl.SetControllerReference(app, current, r.Scheme); err != nil {
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if err := r.Create(ctx, current); err != nil {
+			log.Error(err, "Failed to create ControllerRevision, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("A new revision has been recorded.", "revision", current.Revision, "name", name)
+		revisions = append(revisions, current)
+	case current.Revision < latest:
+		patch := client.MergeFrom(current.DeepCopy())
+		current.Revision = latest + 1
+		if err := r.Patch(ctx, current, patch); err != nil {
+			log.Error(err, "Failed to renumber ControllerRevision, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("A previous revision has become current again.", "revision", current.Revision, "name", name)
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	}
+	app.Status.CurrentRevision = name
+
+	// 当前revision总是排在最后，除此之外最多保留revisionHistoryLimit个历史revision
+	limit := int32(DefaultRevisionHistoryLimit)
+	if app.Spec.RevisionHistoryLimit != nil {
+		limit = *app.Spec.RevisionHistoryLimit
+	}
+	for i := 0; i < len(revisions)-1-int(limit); i++ {
+		if err := r.Delete(ctx, revisions[i]); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete ControllerRevision, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("An old revision has been pruned.", "revision", revisions[i].Revision, "name", revisions[i].Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+// rollback 处理apps.wuyong.cn/rollback-to注解：把指定revision中记录的spec写回Application并移除注解，
+// 随后的调谐会像普通的spec变更一样通过reconcileDeployment和reconcileService重新渲染子资源（包括发布策略）。
+// 注解的值为0时回滚到当前revision之前的一个revision
+func (r *ApplicationReconciler) rollback(ctx context.Context, app *v2.Application) error {
+	log := log.FromContext(ctx)
+
+	value, ok := app.Annotations[shared.AnnotationRollbackTo]
+	if !ok {
+		return nil
+	}
+	target, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || target < 0 {
+		return &RollbackFailedError{Reason: fmt.Sprintf("invalid revision %q", value)}
+	}
+
+	revisions, err := r.listRevisions(ctx, app)
+	if err != nil {
+		return err
+	}
+	var found *appsv1.ControllerRevision
+	for i, revision := range revisions {
+		if target == 0 && revision.Name == app.Status.CurrentRevision && i > 0 {
+			found = revisions[i-1]
+		}
+		if target != 0 && revision.Revision == target {
+			found = revision
+		}
+	}
+	if found == nil {
+		return &RollbackFailedError{Reason: fmt.Sprintf("revision %s of Application %s not found", value, app.Name)}
+	}
+
+	spec := revisionSpec{}
+	if err := json.Unmarshal(found.Data.Raw, &spec); err != nil {
+		return &RollbackFailedError{Reason: fmt.Sprintf("revision %d cannot be decoded: %v", found.Revision, err)}
+	}
+	delete(app.Annotations, shared.AnnotationRollbackTo)
+	app.Spec.Workflow = spec.Workflow
+	app.Spec.Service = spec.Service
+	app.Spec.Components = spec.Components
+	status := app.Status.DeepCopy()
+	if err := r.Update(ctx, app); err != nil {
+		return err
+	}
+	// Update会用API Server返回的对象覆盖app，这里恢复本轮调谐中已经计算出来的状态
+	app.Status = *status
+	log.Info("The Application has been rolled back.", "revision", found.Revision, "name", found.Name)
+	return nil
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// 交出spec.replicas所有权时使用的field manager，它只拥有replicas这一个字段
+const replicasHandoverFieldManager = FieldManager + "-handover"
+
+// autoscalingEnabled 判断Application是否配置了自动扩缩容
+func autoscalingEnabled(app *v2.Application) bool {
+	return app.Spec.Autoscaling != nil
+}
+
+// totalReplicas 返回工作负载当前应有的总副本数：开启自动扩缩容时以HPA调整后的副本数为准，live为HPA作用的Deployment
+func totalReplicas(app *v2.Application, live *appsv1.Deployment) int32 {
+	if autoscalingEnabled(app) && live != nil && live.Spec.Replicas != nil {
+		return *live.Spec.Replicas
+	}
+	return desiredReplicas(app.Spec.Workflow.Replicas)
+}
+
+func (r *ApplicationReconciler) reconcileHPA(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 没有配置自动扩缩容时，删除之前生成的HPA
+	if !autoscalingEnabled(app) {
+		existing := &autoscalingv2.HorizontalPodAutoscaler{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			log.Error(err, "Failed to get HorizontalPodAutoscaler, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete HorizontalPodAutoscaler, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The HorizontalPodAutoscaler has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	hpa := r.buildHPA(app)
+	if err := ctrl.SetControllerReference(app, hpa, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, hpa, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the HorizontalPodAutoscaler.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err := r.apply(ctx, app, hpa)
+	switch {
+	case err == nil:
+		log.Info("The HorizontalPodAutoscaler has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The HorizontalPodAutoscaler has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+	default:
+		log.Error(err, "Failed to apply HorizontalPodAutoscaler, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "HorizontalPodAutoscaler", hpa.Name, conflict)
+	return conflictResult(conflict), nil
+}
+
+// buildHPA 根据spec.autoscaling构造期望的HorizontalPodAutoscaler，作用于主Deployment
+func (r *ApplicationReconciler) buildHPA(app *v2.Application) *autoscalingv2.HorizontalPodAutoscaler {
+	spec := app.Spec.Autoscaling
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	hpa.SetGroupVersionKind(autoscalingv2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler"))
+	hpa.SetName(app.Name)
+	hpa.SetNamespace(app.Namespace)
+	hpa.SetLabels(childLabels(app))
+	hpa.Spec.ScaleTargetRef = autoscalingv2.CrossVersionObjectReference{
+		APIVersion: appsv1.SchemeGroupVersion.String(),
+		Kind:       "Deployment",
+		Name:       app.Name,
+	}
+	hpa.Spec.MinReplicas = spec.MinReplicas
+	hpa.Spec.MaxReplicas = spec.MaxReplicas
+	hpa.Spec.Behavior = spec.Behavior.DeepCopy()
+
+	for _, target := range []struct {
+		name        corev1.ResourceName
+		utilization *int32
+	}{{corev1.ResourceCPU, spec.TargetCPUUtilizationPercentage}, {corev1.ResourceMemory, spec.TargetMemoryUtilizationPercentage}} {
+		if target.utilization == nil {
+			continue
+		}
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: target.name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: target.utilization,
+				},
+			},
+		})
+	}
+	for i := range spec.Metrics {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, *spec.Metrics[i].DeepCopy())
+	}
+	return hpa
+}
+
+// releaseReplicas 开启自动扩缩容后，提交Deployment时不再包含spec.replicas。
+// Server-Side Apply会重置不再被任何manager拥有的字段，直接去掉replicas会让Deployment缩容到默认的1个副本，
+// 因此先用一个只包含replicas的独立manager按照当前值提交一次，接管这个字段，随后由HPA调整
+func (r *ApplicationReconciler) releaseReplicas(ctx context.Context, dp, live *appsv1.Deployment) error {
+	dp.Spec.Replicas = nil
+	if live == nil || live.Spec.Replicas == nil || !ownsReplicas(live) {
+		return nil
+	}
+
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handover.SetNamespace(live.Namespace)
+	handover.SetName(live.Name)
+	if err := unstructured.SetNestedField(handover.Object, int64(*live.Spec.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	if err := r.Patch(ctx, handover, client.Apply, client.FieldOwner(replicasHandoverFieldManager), client.ForceOwnership); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("The replicas of the Deployment have been handed over to the autoscaler.", "replicas", *live.Spec.Replicas)
+	return nil
+}
+
+// reclaimReplicas 关闭自动扩缩容后，spec.replicas可能仍然归交接用的manager或者HPA（kube-controller-manager）所有，
+// 直接提交会产生冲突，Deployment会一直停留在自动扩缩容调整后的副本数。
+// 因此先用交接用的manager按照期望的副本数强制提交一次，随后控制器以相同的值提交时与它共同拥有这个字段，不会冲突。
+// 返回值表示是否执行了接管，此时需要在提交Deployment之后调用releaseHandover
+func (r *ApplicationReconciler) reclaimReplicas(ctx context.Context, dp, live *appsv1.Deployment) (bool, error) {
+	if live == nil || dp.Spec.Replicas == nil || ownsReplicas(live) {
+		return false, nil
+	}
+
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handover.SetNamespace(live.Namespace)
+	handover.SetName(live.Name)
+	if err := unstructured.SetNestedField(handover.Object, int64(*dp.Spec.Replicas), "spec", "replicas"); err != nil {
+		return false, err
+	}
+	if err := r.Patch(ctx, handover, client.Apply, client.FieldOwner(replicasHandoverFieldManager), client.ForceOwnership); err != nil {
+		return false, err
+	}
+	log.FromContext(ctx).Info("The replicas of the Deployment have been taken back from the autoscaler.", "replicas", *dp.Spec.Replicas)
+	return true, nil
+}
+
+// releaseHandover 提交一个不包含任何字段的对象，让交接用的manager放弃它拥有的字段，之后spec.replicas只归控制器所有
+func (r *ApplicationReconciler) releaseHandover(ctx context.Context, dp *appsv1.Deployment) error {
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	handover.SetNamespace(dp.Namespace)
+	handover.SetName(dp.Name)
+	return r.Patch(ctx, handover, client.Apply, client.FieldOwner(replicasHandoverFieldManager), client.ForceOwnership)
+}
+
+// ownsReplicas 判断控制器是否通过Server-Side Apply拥有Deployment的spec.replicas字段
+func ownsReplicas(dp *appsv1.Deployment) bool {
+	for _, entry := range dp.ManagedFields {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]any{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if spec, ok := fields["f:spec"].(map[string]any); ok {
+			if _, ok := spec["f:replicas"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// serviceAccountName 返回Pod使用的ServiceAccount的名称，没有配置spec.identity时为空，Pod模板保持不变
+func serviceAccountName(app *v2.Application) string {
+	if app.Spec.Identity == nil {
+		return ""
+	}
+	if app.Spec.Identity.ServiceAccountName != "" {
+		return app.Spec.Identity.ServiceAccountName
+	}
+	return app.Name
+}
+
+// createsServiceAccount 判断是否需要由控制器创建ServiceAccount
+func createsServiceAccount(app *v2.Application) bool {
+	return app.Spec.Identity != nil && app.Spec.Identity.Create
+}
+
+// roleKind 返回角色的类型，未设置时与API的默认值保持一致
+func roleKind(role v2.RoleReference) string {
+	if role.Kind == "" {
+		return "Role"
+	}
+	return role.Kind
+}
+
+// roleBindingName 返回绑定角色的RoleBinding的名称：<application>-<role|clusterrole>-<角色名>
+func roleBindingName(app *v2.Application, role v2.RoleReference) string {
+	return app.Name + "-" + strings.ToLower(roleKind(role)) + "-" + role.Name
+}
+
+// injectIdentity 让Pod模板使用spec.identity声明的ServiceAccount，ServiceAccount不由控制器创建时，
+// 镜像拉取凭据直接写入Pod模板
+func injectIdentity(app *v2.Application, template *corev1.PodTemplateSpec) {
+	identity := app.Spec.Identity
+	if identity == nil {
+		return
+	}
+	template.Spec.ServiceAccountName = serviceAccountName(app)
+	if identity.Create {
+		return
+	}
+	for _, name := range identity.ImagePullSecrets {
+		template.Spec.ImagePullSecrets = append(template.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+}
+
+func (r *ApplicationReconciler) reconcileIdentity(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var result ctrl.Result
+	desired := sets.New[string]()
+	if identity := app.Spec.Identity; identity != nil {
+		if createsServiceAccount(app) {
+			sa := r.buildServiceAccount(app)
+			conflict, err := r.applyIdentityObject(ctx, app, sa)
+			if err != nil {
+				log.Error(err, "Failed to apply ServiceAccount, will requeue after a short time.")
+				return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+			}
+			setFieldConflict(app, "ServiceAccount", sa.Name, conflict)
+			result = mergeResult(result, conflictResult(conflict))
+		}
+
+		for _, role := range identity.Roles {
+			binding := r.buildRoleBinding(app, role)
+			desired.Insert(binding.Name)
+			conflict, err := r.applyIdentityObject(ctx, app, binding)
+			if err != nil {
+				log.Error(err, "Failed to apply RoleBinding, will requeue after a short time.", "roleBinding", binding.Name)
+				return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+			}
+			setFieldConflict(app, "RoleBinding", binding.Name, conflict)
+			result = mergeResult(result, conflictResult(conflict))
+		}
+	}
+
+	// 删除控制器之前创建、但已经不再需要的ServiceAccount，例如关闭了create或者修改了serviceAccountName
+	saList := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, saList, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app))); err != nil {
+		log.Error(err, "Failed to list ServiceAccounts, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	for i := range saList.Items {
+		sa := &saList.Items[i]
+		if (createsServiceAccount(app) && sa.Name == serviceAccountName(app)) || !metav1.IsControlledBy(sa, app) {
+			continue
+		}
+		if err := r.Delete(ctx, sa); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete ServiceAccount, will requeue after a short time.", "serviceAccount", sa.Name)
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, "ServiceAccount", sa.Name, "")
+		log.Info("The ServiceAccount has been deleted.", "serviceAccount", sa.Name)
+	}
+
+	// 删除已经从spec.identity.roles中移除的角色对应的RoleBinding
+	bindingList := &rbacv1.RoleBindingList{}
+	if err := r.List(ctx, bindingList, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app))); err != nil {
+		log.Error(err, "Failed to list RoleBindings, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	for i := range bindingList.Items {
+		binding := &bindingList.Items[i]
+		if desired.Has(binding.Name) || !metav1.IsControlledBy(binding, app) {
+			continue
+		}
+		if err := r.Delete(ctx, binding); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete RoleBinding, will requeue after a short time.", "roleBinding", binding.Name)
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, "RoleBinding", binding.Name, "")
+		log.Info("The RoleBinding has been deleted.", "roleBinding", binding.Name)
+	}
+	return result, nil
+}
+
+// applyIdentityObject 设置owner reference并提交ServiceAccount或者RoleBinding，返回字段冲突的信息
+func (r *ApplicationReconciler) applyIdentityObject(ctx context.Context, app *v2.Application, obj client.Object) (string, error) {
+	if err := ctrl.SetControllerReference(app, obj, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.checkOwnership(ctx, app, obj, nil); err != nil {
+		return "", err
+	}
+	err := r.apply(ctx, app, obj)
+	switch {
+	case err == nil:
+		log.FromContext(ctx).Info("The identity object has been applied.", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+		return "", nil
+	case errors.IsConflict(err):
+		return err.Error(), nil
+	default:
+		return "", err
+	}
+}
+
+// buildServiceAccount 根据spec.identity构造期望的ServiceAccount
+func (r *ApplicationReconciler) buildServiceAccount(app *v2.Application) *corev1.ServiceAccount {
+	identity := app.Spec.Identity
+
+	sa := &corev1.ServiceAccount{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	sa.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ServiceAccount"))
+	sa.SetName(serviceAccountName(app))
+	sa.SetNamespace(app.Namespace)
+	sa.SetLabels(childLabels(app))
+	sa.AutomountServiceAccountToken = identity.AutomountServiceAccountToken
+	for _, name := range identity.ImagePullSecrets {
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+	return sa
+}
+
+// buildRoleBinding 构造把角色绑定到ServiceAccount的RoleBinding，ClusterRole同样只在Application所在的命名空间生效
+func (r *ApplicationReconciler) buildRoleBinding(app *v2.Application, role v2.RoleReference) *rbacv1.RoleBinding {
+	binding := &rbacv1.RoleBinding{}
+	binding.SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind("RoleBinding"))
+	binding.SetName(roleBindingName(app, role))
+	binding.SetNamespace(app.Namespace)
+	binding.SetLabels(childLabels(app))
+	binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: roleKind(role), Name: role.Name}
+	binding.Subjects = []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      serviceAccountName(app),
+		Namespace: app.Namespace,
+	}}
+	return binding
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func (r *ApplicationReconciler) reconcileIngress(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 没有配置spec.ingress时，删除之前生成的Ingress
+	if app.Spec.Ingress == nil {
+		app.Status.URLs = nil
+		existing := &networkingv1.Ingress{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			log.Error(err, "Failed to get Ingress, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete Ingress, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The Ingress has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	ing := r.buildIngress(app)
+	if err := ctrl.SetControllerReference(app, ing, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, ing, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the Ingress.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err := r.apply(ctx, app, ing)
+	switch {
+	case err == nil:
+		log.Info("The Ingress has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The Ingress has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+	default:
+		log.Error(err, "Failed to apply Ingress, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Ingress", ing.Name, conflict)
+	app.Status.URLs = ingressURLs(app)
+	return conflictResult(conflict), nil
+}
+
+// buildIngress 根据spec.ingress构造期望的Ingress，所有路径都指向reconcileService创建的Service
+func (r *ApplicationReconciler) buildIngress(app *v2.Application) *networkingv1.Ingress {
+	spec := app.Spec.Ingress
+
+	ing := &networkingv1.Ingress{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	ing.SetGroupVersionKind(networkingv1.SchemeGroupVersion.WithKind("Ingress"))
+	ing.SetName(app.Name)
+	ing.SetNamespace(app.Namespace)
+	ing.SetLabels(childLabels(app))
+	ing.SetAnnotations(spec.Annotations)
+	ing.Spec.IngressClassName = spec.IngressClassName
+
+	backend := networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: app.Name, Port: ingressServicePort(app)},
+	}
+	var hosts []string
+	for _, host := range spec.Hosts {
+		rule := networkingv1.IngressRule{Host: host.Host}
+		rule.HTTP = &networkingv1.HTTPIngressRuleValue{}
+		for _, path := range ingressPaths(host) {
+			rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+				Path:     path.Path,
+				PathType: ptr.To(ptr.Deref(path.PathType, networkingv1.PathTypePrefix)),
+				Backend:  backend,
+			})
+		}
+		ing.Spec.Rules = append(ing.Spec.Rules, rule)
+		if host.Host != "" {
+			hosts = append(hosts, host.Host)
+		}
+	}
+	if spec.TLSSecretName != "" {
+		ing.Spec.TLS = []networkingv1.IngressTLS{{Hosts: hosts, SecretName: spec.TLSSecretName}}
+	}
+	return ing
+}
+
+// ingressServicePort 返回Ingress转发到的Service端口：优先使用spec.ingress.servicePort，
+// 否则使用Service的第一个端口，这样Service端口变化时Ingress也会随之更新
+func ingressServicePort(app *v2.Application) networkingv1.ServiceBackendPort {
+	if port := app.Spec.Ingress.ServicePort; port != nil {
+		if port.Type == intstr.String {
+			return networkingv1.ServiceBackendPort{Name: port.StrVal}
+		}
+		return networkingv1.ServiceBackendPort{Number: port.IntVal}
+	}
+	if ports := app.Spec.Service.Ports; len(ports) > 0 {
+		return networkingv1.ServiceBackendPort{Number: ports[0].Port}
+	}
+	return networkingv1.ServiceBackendPort{}
+}
+
+// ingressPaths 返回host下的路径，没有声明路径时默认转发"/"
+func ingressPaths(host v2.IngressHost) []v2.IngressPath {
+	if len(host.Paths) == 0 {
+		return []v2.IngressPath{{Path: "/"}}
+	}
+	return host.Paths
+}
+
+// ingressURLs 根据spec.ingress计算Application可以访问的地址，配置了TLS时使用https
+func ingressURLs(app *v2.Application) []string {
+	scheme := "http"
+	if app.Spec.Ingress.TLSSecretName != "" {
+		scheme = "https"
+	}
+	var urls []string
+	for _, host := range app.Spec.Ingress.Hosts {
+		// 没有host的规则匹配所有请求，无法给出确定的地址
+		if host.Host == "" {
+			continue
+		}
+		for _, path := range ingressPaths(host) {
+			urls = append(urls, fmt.Sprintf("%s://%s%s", scheme, host.Host, path.Path))
+		}
+	}
+	return urls
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// selectorLabels 返回由控制器生成的选择器标签，它们在Application的整个生命周期内保持不变
+func selectorLabels(app *v2.Application) map[string]string {
+	return map[string]string{
+		shared.LabelInstance:       app.Name,
+		shared.LabelApplicationUID: string(app.UID),
+	}
+}
+
+// childLabels 返回子资源自身metadata上的标签：Application的标签加上选择器标签
+func childLabels(app *v2.Application) map[string]string {
+	return mergeLabels(app.Labels, selectorLabels(app))
+}
+
+// podTemplateLabels 返回Pod模板上的标签：用户在模板中声明的标签加上selector要求的标签，
+// selector中的标签优先，保证Deployment的selector一定能够匹配到自己的Pod。
+// 接管的工作负载的selector可能带有之前的Application的UID，选择这些Pod时需要使用podSelector
+func podTemplateLabels(app *v2.Application, selector *metav1.LabelSelector) map[string]string {
+	labels := mergeLabels(app.Spec.Workflow.Template.Labels, selectorLabels(app))
+	if selector != nil {
+		labels = mergeLabels(labels, selector.MatchLabels)
+	}
+	return labels
+}
+
+// mergeLabels 合并多个标签集合，后面的集合覆盖前面的同名标签，不会修改传入的map
+func mergeLabels(sets ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, set := range sets {
+		for k, v := range set {
+			merged[k] = v
+		}
+	}
+	return merged
+}
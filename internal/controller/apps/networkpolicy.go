@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// networkPeerIndex 是Application上的字段索引，索引值为spec.network中引用的其他Application，格式为<namespace>/<name>，
+// 被引用的Application创建或者删除时据此找到需要重新解析选择器标签的Application
+const networkPeerIndex = ".spec.network.applications"
+
+// networkPeerKeys 计算Application在networkPeerIndex中的索引值
+func networkPeerKeys(obj client.Object) []string {
+	app, ok := obj.(*v2.Application)
+	if !ok || app.Spec.Network == nil {
+		return nil
+	}
+	var keys []string
+	for _, peers := range [][]v2.NetworkPeer{app.Spec.Network.IngressFrom, app.Spec.Network.EgressTo} {
+		for _, peer := range peers {
+			if peer.Application != "" {
+				keys = append(keys, peerNamespace(app, peer)+"/"+peer.Application)
+			}
+		}
+	}
+	return keys
+}
+
+// peerNamespace 返回被引用的Application所在的命名空间，默认与当前Application相同
+func peerNamespace(app *v2.Application, peer v2.NetworkPeer) string {
+	if peer.Namespace != "" {
+		return peer.Namespace
+	}
+	return app.Namespace
+}
+
+// applicationsAllowing 把Application的创建和删除映射到在spec.network中引用了它的Application
+func (r *ApplicationReconciler) applicationsAllowing(ctx context.Context, obj client.Object) []ctrl.Request {
+	list := &v2.ApplicationList{}
+	if err := r.List(ctx, list, client.MatchingFields{networkPeerIndex: obj.GetNamespace() + "/" + obj.GetName()}); err != nil {
+		ctrl.Log.WithName("Setup").Error(err, "Failed to list the Applications referencing the Application.", "name", obj.GetName())
+		return nil
+	}
+	requests := make([]ctrl.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
+
+func (r *ApplicationReconciler) reconcileNetworkPolicy(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 没有配置spec.network，或者两个方向都不需要限制时，删除之前生成的NetworkPolicy
+	network := app.Spec.Network
+	if network == nil || (!network.DefaultDeny && len(network.IngressFrom) == 0 && len(network.EgressTo) == 0) {
+		meta.RemoveStatusCondition(&app.Status.Conditions, shared.ConditionNetworkPolicyReady)
+		existing := &networkingv1.NetworkPolicy{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			log.Error(err, "Failed to get NetworkPolicy, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete NetworkPolicy, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The NetworkPolicy has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	np, missing, err := r.buildNetworkPolicy(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to resolve the peers of the NetworkPolicy, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := ctrl.SetControllerReference(app, np, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, np, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the NetworkPolicy.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err = r.apply(ctx, app, np)
+	switch {
+	case err == nil:
+		log.Info("The NetworkPolicy has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The NetworkPolicy has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+	default:
+		log.Error(err, "Failed to apply NetworkPolicy, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "NetworkPolicy", np.Name, conflict)
+
+	// 找不到的Application不会放行任何流量，它们被创建后由Watches重新触发调谐
+	condition := metav1.Condition{
+		Type:               shared.ConditionNetworkPolicyReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             shared.ReasonPeersResolved,
+		Message:            "All peers of spec.network have been resolved",
+		ObservedGeneration: app.Generation,
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = shared.ReasonPeerNotFound
+		condition.Message = fmt.Sprintf("Application(s) %s not found, no traffic is allowed for them", strings.Join(missing, ", "))
+	}
+	meta.SetStatusCondition(&app.Status.Conditions, condition)
+	return conflictResult(conflict), nil
+}
+
+// buildNetworkPolicy 根据spec.network构造期望的NetworkPolicy，选择Application的所有Pod。
+// 每个peer生成一条独立的规则，peer中的ports只作用于它自己；无法解析的Application不生成规则，
+// 避免出现from/to为空、放行所有流量的规则。返回值中的missing是找不到的Application
+func (r *ApplicationReconciler) buildNetworkPolicy(ctx context.Context, app *v2.Application) (*networkingv1.NetworkPolicy, []string, error) {
+	network := app.Spec.Network
+
+	np := &networkingv1.NetworkPolicy{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	np.SetGroupVersionKind(networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"))
+	np.SetName(app.Name)
+	np.SetNamespace(app.Namespace)
+	np.SetLabels(childLabels(app))
+	pods, err := r.podSelector(ctx, app)
+	if err != nil {
+		return nil, nil, err
+	}
+	np.Spec.PodSelector = metav1.LabelSelector{MatchLabels: pods}
+
+	var missing []string
+	if network.DefaultDeny || len(network.IngressFrom) > 0 {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		for _, peer := range network.IngressFrom {
+			resolved, found, err := r.resolvePeer(ctx, app, peer)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !found {
+				missing = append(missing, peerNamespace(app, peer)+"/"+peer.Application)
+				continue
+			}
+			np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+				From:  []networkingv1.NetworkPolicyPeer{resolved},
+				Ports: networkPorts(peer.Ports),
+			})
+		}
+	}
+	if network.DefaultDeny || len(network.EgressTo) > 0 {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		for _, peer := range network.EgressTo {
+			resolved, found, err := r.resolvePeer(ctx, app, peer)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !found {
+				missing = append(missing, peerNamespace(app, peer)+"/"+peer.Application)
+				continue
+			}
+			np.Spec.Egress = append(np.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				To:    []networkingv1.NetworkPolicyPeer{resolved},
+				Ports: networkPorts(peer.Ports),
+			})
+		}
+		// 限制出站流量时默认放行DNS查询，否则Pod无法解析任何域名
+		if ptr.Deref(network.AllowDNS, true) {
+			dns := intstr.FromInt32(53)
+			np.Spec.Egress = append(np.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				Ports: []networkingv1.NetworkPolicyPort{
+					{Protocol: ptr.To(corev1.ProtocolUDP), Port: &dns},
+					{Protocol: ptr.To(corev1.ProtocolTCP), Port: &dns},
+				},
+			})
+		}
+	}
+	return np, missing, nil
+}
+
+// resolvePeer 把spec.network中的peer转换为NetworkPolicyPeer：Application解析为它的podSelector，
+// 命名空间通过kubernetes.io/metadata.name标签选择。被引用的Application不存在时found为false
+func (r *ApplicationReconciler) resolvePeer(ctx context.Context, app *v2.Application, peer v2.NetworkPeer) (networkingv1.NetworkPolicyPeer, bool, error) {
+	if peer.CIDR != "" {
+		return networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: peer.CIDR, Except: peer.Except}}, true, nil
+	}
+
+	var resolved networkingv1.NetworkPolicyPeer
+	namespace := peerNamespace(app, peer)
+	if namespace != app.Namespace || peer.Application == "" {
+		resolved.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: namespace}}
+	}
+	if peer.Application == "" {
+		return resolved, true, nil
+	}
+
+	other := &v2.Application{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: peer.Application}, other); err != nil {
+		if errors.IsNotFound(err) {
+			return resolved, false, nil
+		}
+		return resolved, false, err
+	}
+	pods, err := r.podSelector(ctx, other)
+	if err != nil {
+		return resolved, false, err
+	}
+	resolved.PodSelector = &metav1.LabelSelector{MatchLabels: pods}
+	return resolved, true, nil
+}
+
+// networkPorts 把peer中声明的端口转换为NetworkPolicyPort，没有声明时放行所有端口
+func networkPorts(ports []v2.NetworkPort) []networkingv1.NetworkPolicyPort {
+	var result []networkingv1.NetworkPolicyPort
+	for _, port := range ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		result = append(result, networkingv1.NetworkPolicyPort{Protocol: ptr.To(protocol), Port: ptr.To(port.Port)})
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func (r *ApplicationReconciler) reconcilePDB(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 开启自动扩缩容时以HPA调整后的副本数为准
+	live, err := r.getDeployment(ctx, app, app.Name)
+	if err != nil {
+		log.Error(err, "Failed to get Deployment, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	replicas := totalReplicas(app, live)
+
+	// 没有配置spec.disruption，或者只有一个副本时删除PDB：单副本的PDB会让节点排空一直卡住
+	if app.Spec.Disruption == nil || replicas <= 1 {
+		existing := &policyv1.PodDisruptionBudget{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			log.Error(err, "Failed to get PodDisruptionBudget, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete PodDisruptionBudget, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The PodDisruptionBudget has been deleted.", "replicas", replicas)
+		return ctrl.Result{}, nil
+	}
+
+	pods, err := r.podSelector(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to get the selector of the workload, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	pdb := r.buildPDB(app, replicas, pods)
+	if err := ctrl.SetControllerReference(app, pdb, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, pdb, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the PodDisruptionBudget.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err = r.apply(ctx, app, pdb)
+	switch {
+	case err == nil:
+		log.Info("The PodDisruptionBudget has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The PodDisruptionBudget has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+	default:
+		log.Error(err, "Failed to apply PodDisruptionBudget, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "PodDisruptionBudget", pdb.Name, conflict)
+	return conflictResult(conflict), nil
+}
+
+// buildPDB 根据spec.disruption构造期望的PodDisruptionBudget，通过podSelector返回的标签pods
+// 选择Application的所有Pod（包括金丝雀版本和蓝绿发布的两个颜色）
+func (r *ApplicationReconciler) buildPDB(app *v2.Application, replicas int32, pods map[string]string) *policyv1.PodDisruptionBudget {
+	spec := app.Spec.Disruption
+
+	pdb := &policyv1.PodDisruptionBudget{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	pdb.SetGroupVersionKind(policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget"))
+	pdb.SetName(app.Name)
+	pdb.SetNamespace(app.Namespace)
+	pdb.SetLabels(childLabels(app))
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: pods}
+	pdb.Spec.MinAvailable = spec.MinAvailable
+	pdb.Spec.MaxUnavailable = spec.MaxUnavailable
+	// 都没有设置时，默认允许四分之一的副本同时被驱逐，至少为1
+	if pdb.Spec.MinAvailable == nil && pdb.Spec.MaxUnavailable == nil {
+		pdb.Spec.MaxUnavailable = ptr.To(intstr.FromInt32(max(1, replicas/4)))
+	}
+	// 不健康的Pod总是可以被驱逐，避免它们阻塞节点排空
+	pdb.Spec.UnhealthyPodEvictionPolicy = ptr.To(policyv1.AlwaysAllow)
+	return pdb
+}
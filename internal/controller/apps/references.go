@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// configReferenceIndex 是Application上的字段索引，索引值为Application引用的ConfigMap和Secret，
+// 格式为<Kind>/<name>，用于在ConfigMap或者Secret变化时找到需要重新调谐的Application
+const configReferenceIndex = ".spec.configReferences"
+
+// configReferences 返回Application引用的ConfigMap和Secret的名称：spec.secrets总是包含在内，
+// 开启spec.restartOnConfigChange时还包括Pod模板通过卷、envFrom和env引用的对象
+func configReferences(app *v2.Application) (configMaps, secrets sets.Set[string]) {
+	configMaps, secrets = sets.New[string](), sets.New[string]()
+	for _, ref := range app.Spec.Secrets {
+		secrets.Insert(ref.Name)
+	}
+	if !app.Spec.RestartOnConfigChange {
+		return configMaps, secrets
+	}
+
+	spec := &app.Spec.Workflow.Template.Spec
+	for _, volume := range spec.Volumes {
+		switch {
+		case volume.ConfigMap != nil:
+			configMaps.Insert(volume.ConfigMap.Name)
+		case volume.Secret != nil:
+			secrets.Insert(volume.Secret.SecretName)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps.Insert(source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secrets.Insert(source.Secret.Name)
+				}
+			}
+		}
+	}
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			for _, source := range container.EnvFrom {
+				if source.ConfigMapRef != nil {
+					configMaps.Insert(source.ConfigMapRef.Name)
+				}
+				if source.SecretRef != nil {
+					secrets.Insert(source.SecretRef.Name)
+				}
+			}
+			for _, env := range container.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if env.ValueFrom.ConfigMapKeyRef != nil {
+					configMaps.Insert(env.ValueFrom.ConfigMapKeyRef.Name)
+				}
+				if env.ValueFrom.SecretKeyRef != nil {
+					secrets.Insert(env.ValueFrom.SecretKeyRef.Name)
+				}
+			}
+		}
+	}
+	return configMaps, secrets
+}
+
+// configReferenceKeys 计算Application在configReferenceIndex中的索引值
+func configReferenceKeys(obj client.Object) []string {
+	app, ok := obj.(*v2.Application)
+	if !ok {
+		return nil
+	}
+	configMaps, secrets := configReferences(app)
+	var keys []string
+	for _, name := range sets.List(configMaps) {
+		keys = append(keys, "ConfigMap/"+name)
+	}
+	for _, name := range sets.List(secrets) {
+		keys = append(keys, "Secret/"+name)
+	}
+	return keys
+}
+
+// applicationsReferencing 返回一个handler.MapFunc，把ConfigMap或者Secret的变化映射到引用了它的Application。
+// 事件来自元数据informer，Application从缓存中按索引查询，映射过程不会访问API Server
+func (r *ApplicationReconciler) applicationsReferencing(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		list := &v2.ApplicationList{}
+		if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{configReferenceIndex: kind + "/" + obj.GetName()}); err != nil {
+			ctrl.Log.WithName("Setup").Error(err, "Failed to list the Applications referencing the object.", "kind", kind, "name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(list.Items))
+		for i := range list.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+		return requests
+	}
+}
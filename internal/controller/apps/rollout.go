@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileSecondaryDeployment 提交发布策略生成的第二个Deployment（金丝雀版本或者green），desired为nil时表示不再需要它，
+// 等主Deployment滚动完成后再删除，避免在提升或者中止的过程中损失可用副本
+func (r *ApplicationReconciler) reconcileSecondaryDeployment(ctx context.Context, app *v2.Application, name string, primary, desired *appsv1.Deployment) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("deployment", name)
+
+	if desired == nil {
+		existing, err := r.getDeployment(ctx, app, name)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if existing == nil || !metav1.IsControlledBy(existing, app) || !deploymentRolledOut(primary) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete the Deployment, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The Deployment is no longer needed and has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	if err := ctrl.SetControllerReference(app, desired, r.Scheme); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, desired, nil); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.apply(ctx, app, desired); err != nil {
+		if errors.IsConflict(err) {
+			setFieldConflict(app, "Deployment", desired.Name, err.Error())
+			return conflictResult(err.Error()), nil
+		}
+		log.Error(err, "Failed to apply the Deployment, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Deployment", desired.Name, "")
+	log.Info("The Deployment has been applied.", "replicas", *desired.Spec.Replicas)
+	return ctrl.Result{}, nil
+}
+
+// takeRolloutAction 读取并移除Application上的apps.wuyong.cn/rollout-action注解，返回请求的操作
+func (r *ApplicationReconciler) takeRolloutAction(ctx context.Context, app *v2.Application) (string, error) {
+	action, ok := app.Annotations[shared.AnnotationRolloutAction]
+	if !ok {
+		return "", nil
+	}
+	patch := client.MergeFrom(app.DeepCopy())
+	delete(app.Annotations, shared.AnnotationRolloutAction)
+	status := app.Status.DeepCopy()
+	if err := r.Patch(ctx, app, patch); err != nil {
+		return "", err
+	}
+	// Patch会用API Server返回的对象覆盖app，这里恢复本轮调谐中已经计算出来的状态
+	app.Status = *status
+
+	switch action {
+	case shared.RolloutActionPromote, shared.RolloutActionResume, shared.RolloutActionAbort:
+		log.FromContext(ctx).Info("Handling the rollout action.", "action", action)
+		return action, nil
+	default:
+		log.FromContext(ctx).Info("Ignoring an unknown rollout action.", "action", action)
+		return "", nil
+	}
+}
+
+// getDeployment 查询指定名称的Deployment，不存在时返回nil
+func (r *ApplicationReconciler) getDeployment(ctx context.Context, app *v2.Application, name string) (*appsv1.Deployment, error) {
+	dp := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, dp); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return dp, nil
+}
+
+// workloadReady 判断Deployment是否已经以指定的Pod模板和副本数全部可用
+func workloadReady(dp *appsv1.Deployment, revision string, replicas int32) bool {
+	if replicas == 0 {
+		return true
+	}
+	if dp == nil || dp.Annotations[shared.AnnotationRevision] != revision {
+		return false
+	}
+	return dp.Spec.Replicas != nil && *dp.Spec.Replicas == replicas && deploymentRolledOut(dp)
+}
+
+// deploymentRolledOut 判断Deployment的滚动更新是否已经完成
+func deploymentRolledOut(dp *appsv1.Deployment) bool {
+	replicas := desiredReplicas(dp.Spec.Replicas)
+	return dp.Status.ObservedGeneration >= dp.Generation &&
+		dp.Status.UpdatedReplicas == replicas &&
+		dp.Status.Replicas == replicas &&
+		dp.Status.AvailableReplicas >= replicas
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// HTTPRouteGVK 是控制器生成的Gateway API HTTPRoute的类型。控制器通过unstructured客户端访问它，
+// 编译时不依赖Gateway API的Go模块，集群中没有安装CRD时也能正常启动
+var HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+// GatewayAPIInstalled 在启动时通过RESTMapper判断集群中是否安装了HTTPRoute的CRD
+func GatewayAPIInstalled(mapper meta.RESTMapper) (bool, error) {
+	if _, err := mapper.RESTMapping(HTTPRouteGVK.GroupKind(), HTTPRouteGVK.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// routeName 返回spec.routes中的路由对应的HTTPRoute名称
+func routeName(app *v2.Application, route v2.HTTPRouteSpec) string {
+	return app.Name + "-" + route.Name
+}
+
+func (r *ApplicationReconciler) reconcileRoutes(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 集群中没有安装Gateway API时无法生成HTTPRoute，通过RoutesReady condition告知用户，而不是不断重试
+	if !r.GatewayAPIAvailable {
+		if len(app.Spec.Routes) == 0 {
+			meta.RemoveStatusCondition(&app.Status.Conditions, shared.ConditionRoutesReady)
+			return ctrl.Result{}, nil
+		}
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:   shared.ConditionRoutesReady,
+			Status: metav1.ConditionFalse,
+			Reason: shared.ReasonGatewayAPINotInstalled,
+			Message: fmt.Sprintf("spec.routes requires the Gateway API CRDs (%s), install them and restart the operator",
+				HTTPRouteGVK.GroupVersion()),
+			ObservedGeneration: app.Generation,
+		})
+		return ctrl.Result{}, nil
+	}
+
+	var result ctrl.Result
+	desired := sets.New[string]()
+	for _, route := range app.Spec.Routes {
+		obj, err := r.buildHTTPRoute(app, route)
+		if err != nil {
+			log.Error(err, "Failed to build HTTPRoute.", "route", route.Name)
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		desired.Insert(obj.GetName())
+		if err := ctrl.SetControllerReference(app, obj, r.Scheme); err != nil {
+			log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if err := r.checkOwnership(ctx, app, obj, nil); err != nil {
+			log.Error(err, "Failed to check the ownership of the HTTPRoute.", "route", route.Name)
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+
+		var conflict string
+		err = r.apply(ctx, app, obj)
+		switch {
+		case err == nil:
+			log.Info("The HTTPRoute has been applied.", "route", obj.GetName())
+		case errors.IsConflict(err):
+			log.Info("The HTTPRoute has field conflicts with other managers.", "route", obj.GetName(), "conflict", err.Error())
+			conflict = err.Error()
+		default:
+			log.Error(err, "Failed to apply HTTPRoute, will requeue after a short time.", "route", obj.GetName())
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, HTTPRouteGVK.Kind, obj.GetName(), conflict)
+		result = mergeResult(result, conflictResult(conflict))
+	}
+
+	// 删除已经从spec.routes中移除的HTTPRoute
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(HTTPRouteGVK.GroupVersion().WithKind(HTTPRouteGVK.Kind + "List"))
+	if err := r.List(ctx, list, client.InNamespace(app.Namespace), client.MatchingLabels(selectorLabels(app))); err != nil {
+		log.Error(err, "Failed to list HTTPRoutes, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if desired.Has(obj.GetName()) || !metav1.IsControlledBy(obj, app) {
+			continue
+		}
+		if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete HTTPRoute, will requeue after a short time.", "route", obj.GetName())
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		setFieldConflict(app, HTTPRouteGVK.Kind, obj.GetName(), "")
+		log.Info("The HTTPRoute has been deleted.", "route", obj.GetName())
+	}
+
+	if len(app.Spec.Routes) == 0 {
+		meta.RemoveStatusCondition(&app.Status.Conditions, shared.ConditionRoutesReady)
+	} else {
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               shared.ConditionRoutesReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             shared.ReasonRoutesApplied,
+			Message:            "Applied HTTPRoute(s) " + strings.Join(sets.List(desired), ", "),
+			ObservedGeneration: app.Generation,
+		})
+	}
+	return result, nil
+}
+
+// buildHTTPRoute 根据spec.routes中的一项构造期望的HTTPRoute。API中的路由类型与Gateway API的字段同名，
+// 补全默认的后端之后直接序列化为HTTPRoute的spec
+func (r *ApplicationReconciler) buildHTTPRoute(app *v2.Application, route v2.HTTPRouteSpec) (*unstructured.Unstructured, error) {
+	route = *route.DeepCopy()
+	if len(route.Rules) == 0 {
+		route.Rules = []v2.HTTPRouteRule{{}}
+	}
+	for i := range route.Rules {
+		rule := &route.Rules[i]
+		if len(rule.BackendRefs) == 0 {
+			rule.BackendRefs = []v2.HTTPBackendRef{{}}
+		}
+		// 没有指定名称的后端指向reconcileService创建的Service，没有指定端口时使用Service的第一个端口
+		for j := range rule.BackendRefs {
+			ref := &rule.BackendRefs[j]
+			if ref.Name == "" {
+				ref.Name = app.Name
+			}
+			if ref.Port == nil && ref.Name == app.Name && len(app.Spec.Service.Ports) > 0 {
+				ref.Port = &app.Spec.Service.Ports[0].Port
+			}
+		}
+	}
+
+	raw, err := json.Marshal(struct {
+		ParentRefs []v2.RouteParentRef `json:"parentRefs"`
+		Hostnames  []string            `json:"hostnames,omitempty"`
+		Rules      []v2.HTTPRouteRule  `json:"rules"`
+	}{route.ParentRefs, route.Hostnames, route.Rules})
+	if err != nil {
+		return nil, err
+	}
+	spec := map[string]any{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetGroupVersionKind(HTTPRouteGVK)
+	obj.SetName(routeName(app, route))
+	obj.SetNamespace(app.Namespace)
+	obj.SetLabels(childLabels(app))
+	return obj, nil
+}
@@ -2,13 +2,14 @@ package controller
 
 import (
 	"context"
-	"reflect"
 
 	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -16,59 +17,113 @@ func (r *ApplicationReconciler) reconcileService(ctx context.Context, app *v2.Ap
 
 	log := log.FromContext(ctx)
 
-	// 根据Application的Namespace和Name信息来查询对应的Servce资源
-	var svc = &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{
-		Namespace: app.Namespace,
-		Name:      app.Name,
-	}, svc)
-
-	// 如果查到了对应的Service
-	if err == nil {
-		log.Info("The Service has already exist.")
-		// 利用reflect.DeepEqual判断现存的Service状态相比之前的Application中的状态是否有更新，如果有就更新Application中的Service状态
-		if reflect.DeepEqual(svc.Status, app.Status.Network) {
-			return ctrl.Result{}, err
-		}
-
-		// Service状态发生变化，将现存的Service状态赋值给Application中的Service状态，更新Application对Service的追踪
-		app.Status.Network = svc.Status
-		// 调用更新
-		if err = r.Status().Update(ctx, app); err != nil {
-			log.Error(err, "Failed to update Application Status")
+	// Job和CronJob默认不生成Service，只有在spec.service中显式声明了端口时才生成
+	if !serviceEnabled(app) {
+		if err := r.deleteService(ctx, app, app.Name); err != nil {
+			log.Error(err, "Failed to delete Service, will requeue after a short time.")
 			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 		}
-		log.Info("The Application status has been updated.")
-		return ctrl.Result{}, nil
+		setFieldConflict(app, "Service", app.Name, "")
+		app.Status.Network = corev1.ServiceStatus{}
+		return r.reconcileAuxiliaryServices(ctx, app)
 	}
 
-	// 如果不是Not Found的错误，间隔一段时间后重试
-	if !errors.IsNotFound(err) {
-		log.Error(err, "Failed to get Service, will requeue after a short time.")
+	// 根据Application中的ServiceSpec，计算期望的Service
+	pods, err := r.podSelector(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to get the selector of the workload, will requeue after a short time.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
-
-	// 如果是Not Found的错误，根据Application中的ServiceSpec，创建一个新的Service
-	newSvc := &corev1.Service{}
-	newSvc.SetName(app.Name)
-	newSvc.SetNamespace(app.Namespace)
-	newSvc.SetLabels(app.Labels)
-	newSvc.Spec = app.Spec.Service.ServiceSpec
-	newSvc.Spec.Selector = app.Labels
-
+	svc := r.buildService(app, pods)
 	// 设置所有者引用，将Application设置为Service的所有者，
 	// 当Application被删除时，Service会被自动删除
-	if err := ctrl.SetControllerReference(app, newSvc, r.Scheme); err != nil {
+	if err := ctrl.SetControllerReference(app, svc, r.Scheme); err != nil {
 		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	// 调用客户端API创建Service资源
-	if err := r.Create(ctx, newSvc); err != nil {
-		log.Error(err, "Faield to create Service, will requeue after a short time.")
+	// 同名的Service已经存在但不属于当前Application时，只有在允许接管时才继续
+	if err := r.checkOwnership(ctx, app, svc, nil); err != nil {
+		log.Error(err, "Failed to check the ownership of the Service.")
 		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
 	}
 
-	log.Info("The Service has been created.")
-	return ctrl.Result{}, nil
+	// 通过Server-Side Apply提交期望的Service。clusterIP、clusterIPs、已分配的nodePort以及healthCheckNodePort
+	// 都是由API Server分配的，只要Application中没有显式指定，控制器就不会拥有这些字段，它们会在更新时被保留下来
+	var conflict string
+	err = r.apply(ctx, app, svc)
+	switch {
+	case err == nil:
+		log.Info("The Service has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The Service has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, svc); err != nil {
+			log.Error(err, "Failed to get Service, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	default:
+		log.Error(err, "Faield to apply Service, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	// 将Service的状态同步到Application中，由Reconcile统一计算conditions并更新Application状态
+	setFieldConflict(app, "Service", svc.Name, conflict)
+	app.Status.Network = svc.Status
+
+	result, err := r.reconcileAuxiliaryServices(ctx, app)
+	if err != nil {
+		return result, err
+	}
+	return mergeResult(conflictResult(conflict), result), nil
+}
+
+// reconcileAuxiliaryServices 调谐蓝绿发布的预览Service和StatefulSet的headless Service，不需要时删除它们
+func (r *ApplicationReconciler) reconcileAuxiliaryServices(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	previewResult, err := r.reconcilePreviewService(ctx, app)
+	if err != nil {
+		return previewResult, err
+	}
+	headlessResult, err := r.reconcileHeadlessService(ctx, app)
+	if err != nil {
+		return headlessResult, err
+	}
+	return mergeResult(previewResult, headlessResult), nil
+}
+
+// serviceEnabled 判断是否需要生成主Service：Deployment和StatefulSet总是需要，Job和CronJob只有声明了端口时才需要
+func serviceEnabled(app *v2.Application) bool {
+	return !batchEnabled(app) || len(app.Spec.Service.Ports) > 0
+}
+
+// deleteService 删除由Application控制的指定名称的Service
+func (r *ApplicationReconciler) deleteService(ctx context.Context, app *v2.Application, name string) error {
+	existing := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, existing); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(existing, app) {
+		return nil
+	}
+	if err := r.Delete(ctx, existing); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("The Service is no longer needed and has been deleted.", "service", name)
+	return nil
+}
+
+// buildService 根据Application资源实例信息来构造期望的Service实例，pods为podSelector返回的标签
+func (r *ApplicationReconciler) buildService(app *v2.Application, pods map[string]string) *corev1.Service {
+	svc := &corev1.Service{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	svc.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+	svc.SetName(app.Name)
+	svc.SetNamespace(app.Namespace)
+	svc.SetLabels(childLabels(app))
+	svc.SetAnnotations(app.Spec.Service.Annotations)
+	svc.Spec = *app.Spec.Service.ServiceSpec.DeepCopy()
+	// 使用工作负载的选择器标签，避免共享标签的多个Application互相选中对方的Pod
+	// 使用蓝绿发布时只选择当前生效颜色的Pod
+	svc.Spec.Selector = serviceSelector(app, pods)
+	return svc
 }
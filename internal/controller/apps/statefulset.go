@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// statefulSetEnabled 判断Application是否以StatefulSet运行
+func statefulSetEnabled(app *v2.Application) bool {
+	return app.Spec.Workload != nil && app.Spec.Workload.Kind == v2.WorkloadStatefulSet
+}
+
+// headlessServiceName 返回管理StatefulSet网络标识的headless Service的名称：
+// 主Service本身就是headless时直接使用它，否则使用单独生成的<application>-headless
+func headlessServiceName(app *v2.Application) string {
+	if app.Spec.Service.ClusterIP == corev1.ClusterIPNone {
+		return app.Name
+	}
+	return app.Name + "-headless"
+}
+
+// needsHeadlessService 判断是否需要在主Service之外单独生成headless Service
+func needsHeadlessService(app *v2.Application) bool {
+	return statefulSetEnabled(app) && headlessServiceName(app) != app.Name
+}
+
+func (r *ApplicationReconciler) reconcileStatefulSet(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// 从其他类型切换到StatefulSet时，删除之前生成的Deployment（包括金丝雀版本和蓝绿发布的green Deployment）等工作负载
+	if err := r.deleteOtherWorkloads(ctx, app); err != nil {
+		log.Error(err, "Failed to delete the previous workloads, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	selector, err := r.statefulSetSelector(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to get StatefulSet, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	cfg, err := r.reconcileConfig(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to reconcile the configuration, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	sts := r.buildStatefulSet(app, selector, cfg)
+	if err := ctrl.SetControllerReference(app, sts, r.Scheme); err != nil {
+		log.Error(err, "Failed to SetControllerReference, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, sts, func(live client.Object) error {
+		if sel := live.(*appsv1.StatefulSet).Spec.Selector; sel != nil && len(sel.MatchExpressions) > 0 {
+			return fmt.Errorf("its immutable selector uses matchExpressions")
+		}
+		return nil
+	}); err != nil {
+		log.Error(err, "Failed to check the ownership of the StatefulSet.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	var conflict string
+	err = r.apply(ctx, app, sts)
+	switch {
+	case err == nil:
+		log.Info("The StatefulSet has been applied.")
+	case errors.IsConflict(err):
+		log.Info("The StatefulSet has field conflicts with other managers.", "conflict", err.Error())
+		conflict = err.Error()
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, sts); err != nil {
+			log.Error(err, "Failed to get StatefulSet, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+	default:
+		log.Error(err, "Failed to apply StatefulSet, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+
+	setFieldConflict(app, "StatefulSet", sts.Name, conflict)
+	app.Status.Workflow = statefulSetStatus(sts)
+
+	if err := r.pruneConfigMaps(ctx, app, &sts.Spec.Template); err != nil {
+		log.Error(err, "Failed to prune the old ConfigMaps, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	return conflictResult(conflict), nil
+}
+
+// statefulSetSelector 返回StatefulSet使用的selector。StatefulSet的selector同样是不可变的：
+// 已经存在的StatefulSet沿用它当前的selector，headless Service也必须使用同一个selector才能选中它的Pod
+func (r *ApplicationReconciler) statefulSetSelector(ctx context.Context, app *v2.Application) (*metav1.LabelSelector, error) {
+	live := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, live); err != nil {
+		if errors.IsNotFound(err) {
+			return &metav1.LabelSelector{MatchLabels: selectorLabels(app)}, nil
+		}
+		return nil, err
+	}
+	if live.Spec.Selector == nil {
+		return &metav1.LabelSelector{MatchLabels: selectorLabels(app)}, nil
+	}
+	return live.Spec.Selector, nil
+}
+
+// buildStatefulSet 根据Application构造期望的StatefulSet：副本数、Pod模板等通用字段来自spec.workflow，
+// StatefulSet特有的字段来自spec.workload.statefulSet
+func (r *ApplicationReconciler) buildStatefulSet(app *v2.Application, selector *metav1.LabelSelector, cfg *renderedConfig) *appsv1.StatefulSet {
+	workflow := app.Spec.Workflow.DeploymentSpec.DeepCopy()
+
+	sts := &appsv1.StatefulSet{}
+	// Server-Side Apply要求请求体中带有apiVersion和kind
+	sts.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("StatefulSet"))
+	sts.SetName(app.Name)
+	sts.SetNamespace(app.Namespace)
+	sts.SetLabels(childLabels(app))
+	sts.Spec.Replicas = workflow.Replicas
+	sts.Spec.Selector = selector
+	sts.Spec.Template = workflow.Template
+	sts.Spec.Template.SetLabels(podTemplateLabels(app, selector))
+	injectConfig(&sts.Spec.Template, cfg)
+	injectIdentity(app, &sts.Spec.Template)
+	sts.Spec.MinReadySeconds = workflow.MinReadySeconds
+	sts.Spec.RevisionHistoryLimit = workflow.RevisionHistoryLimit
+	sts.Spec.ServiceName = headlessServiceName(app)
+
+	if template := app.Spec.Workload.StatefulSet; template != nil {
+		template = template.DeepCopy()
+		sts.Spec.VolumeClaimTemplates = template.VolumeClaimTemplates
+		sts.Spec.PodManagementPolicy = template.PodManagementPolicy
+		if template.UpdateStrategy != nil {
+			sts.Spec.UpdateStrategy = *template.UpdateStrategy
+		}
+		sts.Spec.PersistentVolumeClaimRetentionPolicy = template.PersistentVolumeClaimRetentionPolicy
+	}
+	return sts
+}
+
+// statefulSetStatus 把StatefulSet的状态转换为Application状态中使用的DeploymentStatus。
+// StatefulSet没有Available condition，所有副本都可用时认为可用
+func statefulSetStatus(sts *appsv1.StatefulSet) appsv1.DeploymentStatus {
+	status := appsv1.DeploymentStatus{
+		ObservedGeneration:  sts.Status.ObservedGeneration,
+		Replicas:            sts.Status.Replicas,
+		UpdatedReplicas:     sts.Status.UpdatedReplicas,
+		ReadyReplicas:       sts.Status.ReadyReplicas,
+		AvailableReplicas:   sts.Status.AvailableReplicas,
+		UnavailableReplicas: max(0, sts.Status.Replicas-sts.Status.AvailableReplicas),
+	}
+	available := appsv1.DeploymentCondition{
+		Type:    appsv1.DeploymentAvailable,
+		Status:  corev1.ConditionFalse,
+		Reason:  "MinimumReplicasUnavailable",
+		Message: "StatefulSet does not have all replicas available.",
+	}
+	if sts.Status.AvailableReplicas >= desiredReplicas(sts.Spec.Replicas) {
+		available.Status = corev1.ConditionTrue
+		available.Reason = "MinimumReplicasAvailable"
+		available.Message = "StatefulSet has all replicas available."
+	}
+	status.Conditions = []appsv1.DeploymentCondition{available}
+	return status
+}
+
+// reconcileHeadlessService 以StatefulSet运行时生成headless Service，为每个Pod提供稳定的DNS记录
+func (r *ApplicationReconciler) reconcileHeadlessService(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	name := app.Name + "-headless"
+	if !needsHeadlessService(app) {
+		existing := &corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: name}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		if !metav1.IsControlledBy(existing, app) {
+			return ctrl.Result{}, nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete the headless Service, will requeue after a short time.")
+			return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+		}
+		log.Info("The headless Service has been deleted.")
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := r.statefulSetSelector(ctx, app)
+	if err != nil {
+		log.Error(err, "Failed to get StatefulSet, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	svc := buildHeadlessService(app, selector)
+	if err := ctrl.SetControllerReference(app, svc, r.Scheme); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.checkOwnership(ctx, app, svc, nil); err != nil {
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	if err := r.apply(ctx, app, svc); err != nil {
+		if errors.IsConflict(err) {
+			setFieldConflict(app, "Service", svc.Name, err.Error())
+			return conflictResult(err.Error()), nil
+		}
+		log.Error(err, "Failed to apply the headless Service, will requeue after a short time.")
+		return ctrl.Result{RequeueAfter: GenericRequeueDuration}, err
+	}
+	setFieldConflict(app, "Service", svc.Name, "")
+	return ctrl.Result{}, nil
+}
+
+// buildHeadlessService 构造选择StatefulSet所有Pod的headless Service，端口与主Service相同，
+// selector与StatefulSet的selector相同。未就绪的Pod同样发布DNS记录，便于有状态应用在启动时互相发现
+func buildHeadlessService(app *v2.Application, selector *metav1.LabelSelector) *corev1.Service {
+	svc := &corev1.Service{}
+	svc.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+	svc.SetName(headlessServiceName(app))
+	svc.SetNamespace(app.Namespace)
+	svc.SetLabels(childLabels(app))
+	svc.Spec.ClusterIP = corev1.ClusterIPNone
+	svc.Spec.PublishNotReadyAddresses = true
+	for _, port := range app.Spec.Service.Ports {
+		port.NodePort = 0
+		svc.Spec.Ports = append(svc.Spec.Ports, port)
+	}
+	svc.Spec.Selector = selector.MatchLabels
+	return svc
+}
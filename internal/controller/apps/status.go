@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// updateStatus 根据子资源的状态和本轮调谐的错误计算Application的conditions、observedGeneration和phase，
+// 只有状态相比original发生变化时才会调用API Server更新状态
+func (r *ApplicationReconciler) updateStatus(ctx context.Context, app *v2.Application, original *v2.ApplicationStatus, reconcileErr error) error {
+	log := log.FromContext(ctx)
+
+	setConditions(app, reconcileErr)
+	app.Status.ObservedGeneration = app.Generation
+	app.Status.Phase = computePhase(app)
+
+	if equality.Semantic.DeepEqual(original, &app.Status) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, app); err != nil {
+		return err
+	}
+	log.Info("The Application status has been updated.", "phase", app.Status.Phase)
+	return nil
+}
+
+// setConditions 计算Available、Progressing和Degraded三个标准condition。
+// meta.SetStatusCondition只会在condition的status变化时才更新lastTransitionTime
+func setConditions(app *v2.Application, reconcileErr error) {
+	wf := app.Status.Workflow
+	desired := desiredReplicas(app.Spec.Workflow.Replicas)
+	// 开启自动扩缩容时副本数由HPA决定，以Deployment当前的副本数为准，但不少于minReplicas
+	if autoscalingEnabled(app) {
+		desired = max(wf.Replicas, ptr.Deref(app.Spec.Autoscaling.MinReplicas, 1))
+	}
+
+	// Available：直接沿用Deployment自身的Available condition
+	available := metav1.Condition{
+		Type:    shared.ConditionAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  shared.ReasonMinimumReplicasUnavailable,
+		Message: fmt.Sprintf("%d of %d replicas available", wf.AvailableReplicas, desired),
+	}
+	if desired == 0 || deploymentConditionTrue(wf, appsv1.DeploymentAvailable) {
+		available.Status = metav1.ConditionTrue
+		available.Reason = shared.ReasonMinimumReplicasAvailable
+	}
+
+	// Progressing：所有副本都已经更新并可用时，认为滚动更新已经完成
+	progressing := metav1.Condition{
+		Type:    shared.ConditionProgressing,
+		Status:  metav1.ConditionTrue,
+		Reason:  shared.ReasonRolloutInProgress,
+		Message: fmt.Sprintf("%d of %d updated replicas available", wf.AvailableReplicas, desired),
+	}
+	if wf.UpdatedReplicas == desired && wf.Replicas == desired && wf.AvailableReplicas == desired {
+		progressing.Status = metav1.ConditionFalse
+		progressing.Reason = shared.ReasonRolloutComplete
+	}
+	// 金丝雀或者蓝绿发布尚未完成时，即使主Deployment已经稳定，也认为仍在发布中
+	if rollout := app.Status.Rollout; rollout != nil && (rollout.Phase == v2.RolloutProgressing || rollout.Phase == v2.RolloutPaused) {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = shared.ReasonRolloutInProgress
+		progressing.Message = rollout.Message
+	}
+
+	// Job和CronJob没有需要保持可用的副本，改为根据Job的运行情况计算
+	if batchEnabled(app) {
+		available, progressing = batchConditions(app.Status.Batch)
+	}
+
+	// 组件的Deployment同样需要可用并且完成滚动更新
+	unavailable, rolling, failed := componentStates(app)
+	if len(unavailable) > 0 {
+		available.Status = metav1.ConditionFalse
+		available.Reason = shared.ReasonMinimumReplicasUnavailable
+		available.Message = "Components not available: " + strings.Join(unavailable, ", ")
+	}
+	if len(rolling) > 0 && progressing.Status == metav1.ConditionFalse {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = shared.ReasonRolloutInProgress
+		progressing.Message = "Components rolling out: " + strings.Join(rolling, ", ")
+	}
+
+	// Degraded：调谐出错、存在字段冲突、最近一次运行的Job失败、Deployment自身报告失败或者Pod出现故障
+	degraded := metav1.Condition{
+		Type:    shared.ConditionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  shared.ReasonAsExpected,
+		Message: "The Application is in the desired state",
+	}
+	var refused *AdoptionRefusedError
+	var rollbackFailed *RollbackFailedError
+	switch {
+	case stderrors.As(reconcileErr, &refused):
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = shared.ReasonAdoptionRefused
+		degraded.Message = refused.Error()
+	case stderrors.As(reconcileErr, &rollbackFailed):
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = shared.ReasonRollbackFailed
+		degraded.Message = rollbackFailed.Error()
+	case reconcileErr != nil:
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = shared.ReasonReconcileError
+		degraded.Message = reconcileErr.Error()
+	case len(app.Status.Conflicts) > 0:
+		var children []string
+		for _, c := range app.Status.Conflicts {
+			children = append(children, c.Kind+"/"+c.Name)
+		}
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = shared.ReasonFieldConflict
+		degraded.Message = "Field conflicts on " + strings.Join(children, ", ")
+	case batchEnabled(app) && lastRunFailed(app.Status.Batch):
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = shared.ReasonJobFailed
+		degraded.Message = fmt.Sprintf("The last Job failed at %s", app.Status.Batch.LastFailureTime.UTC().Format(time.RFC3339))
+	default:
+		if c := deploymentCondition(wf, appsv1.DeploymentProgressing); c != nil && c.Reason == "ProgressDeadlineExceeded" {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = shared.ReasonProgressDeadlineExceeded
+			degraded.Message = c.Message
+			progressing.Status = metav1.ConditionFalse
+			progressing.Reason = shared.ReasonProgressDeadlineExceeded
+			progressing.Message = c.Message
+		} else if c := deploymentCondition(wf, appsv1.DeploymentReplicaFailure); c != nil && c.Status == corev1.ConditionTrue {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = shared.ReasonReplicaFailure
+			degraded.Message = c.Message
+		} else if len(failed) > 0 {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = shared.ReasonComponentFailed
+			degraded.Message = "Components failed: " + strings.Join(failed, ", ")
+		}
+		// Pod的失败原因比Deployment和组件报告的状态更具体，存在时优先报告
+		if len(app.Status.PodFailures) > 0 {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = shared.ReasonPodFailure
+			degraded.Message = podFailuresMessage(app.Status.PodFailures)
+		}
+	}
+
+	for _, c := range []metav1.Condition{available, progressing, degraded} {
+		c.ObservedGeneration = app.Generation
+		meta.SetStatusCondition(&app.Status.Conditions, c)
+	}
+
+	// Suspended：只在Application被暂停时存在
+	if app.Spec.Suspend {
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               shared.ConditionSuspended,
+			Status:             metav1.ConditionTrue,
+			Reason:             shared.ReasonSuspended,
+			Message:            "Reconciliation is suspended, the children are not changed by the operator",
+			ObservedGeneration: app.Generation,
+		})
+	} else {
+		meta.RemoveStatusCondition(&app.Status.Conditions, shared.ConditionSuspended)
+	}
+}
+
+// computePhase 根据conditions汇总出一个简短的phase，便于kubectl get直接查看
+func computePhase(app *v2.Application) shared.ApplicationPhase {
+	conditions := app.Status.Conditions
+	switch {
+	case meta.IsStatusConditionTrue(conditions, shared.ConditionDegraded):
+		return shared.PhaseDegraded
+	case meta.IsStatusConditionTrue(conditions, shared.ConditionSuspended):
+		return shared.PhaseSuspended
+	case meta.IsStatusConditionTrue(conditions, shared.ConditionWaitingForDependencies):
+		return shared.PhasePending
+	case meta.IsStatusConditionTrue(conditions, shared.ConditionProgressing):
+		return shared.PhaseProgressing
+	case meta.IsStatusConditionTrue(conditions, shared.ConditionAvailable):
+		return shared.PhaseRunning
+	default:
+		return shared.PhasePending
+	}
+}
+
+func deploymentCondition(status appsv1.DeploymentStatus, condType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func deploymentConditionTrue(status appsv1.DeploymentStatus, condType appsv1.DeploymentConditionType) bool {
+	c := deploymentCondition(status, condType)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
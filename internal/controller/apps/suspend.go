@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// observeChildren 在Application被暂停时只读取子资源的状态，不做任何修改，
+// 这样手工修改的Deployment不会被控制器改回去，而Application的状态仍然能够反映子资源的实际情况
+func (r *ApplicationReconciler) observeChildren(ctx context.Context, app *v2.Application) error {
+	log := log.FromContext(ctx)
+
+	if err := r.observeWorkload(ctx, app); err != nil {
+		return err
+	}
+
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, svc); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Error(err, "Failed to get Service.")
+			return err
+		}
+	} else {
+		app.Status.Network = svc.Status
+	}
+
+	if err := r.observeComponents(ctx, app); err != nil {
+		log.Error(err, "Failed to observe the components.")
+		return err
+	}
+
+	log.Info("The Application is suspended, the children are left unchanged.")
+	return nil
+}
+
+// observeWorkload 把工作负载的状态同步到Application中：StatefulSet的状态需要转换，Job和CronJob汇总Job的运行情况，
+// 蓝绿发布时反映主Service当前选中的Deployment
+func (r *ApplicationReconciler) observeWorkload(ctx context.Context, app *v2.Application) error {
+	log := log.FromContext(ctx)
+
+	if batchEnabled(app) {
+		if _, err := r.observeBatch(ctx, app); err != nil {
+			log.Error(err, "Failed to observe the Jobs.")
+			return err
+		}
+		return nil
+	}
+
+	if statefulSetEnabled(app) {
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, sts); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			log.Error(err, "Failed to get StatefulSet.")
+			return err
+		}
+		app.Status.Workflow = statefulSetStatus(sts)
+		return nil
+	}
+
+	name := app.Name
+	if activeColor(app) == shared.ColorGreen {
+		name = greenName(app)
+	}
+	dp, err := r.getDeployment(ctx, app, name)
+	if err != nil {
+		log.Error(err, "Failed to get Deployment.")
+		return err
+	}
+	if dp != nil {
+		app.Status.Workflow = dp.Status
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+
+	v2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// workloadKind 返回Application生成的工作负载类型，没有配置spec.workload时为Deployment
+func workloadKind(app *v2.Application) v2.WorkloadKind {
+	if app.Spec.Workload == nil || app.Spec.Workload.Kind == "" {
+		return v2.WorkloadDeployment
+	}
+	return app.Spec.Workload.Kind
+}
+
+// podSelector 返回选择主工作负载所有Pod（包括金丝雀版本和蓝绿发布的两个颜色）的标签。
+// 工作负载的selector是不可变的：接管或者以Retain策略保留下来的Deployment、StatefulSet沿用它原来的selector，
+// 其中的application-uid可能属于之前的Application，Pod上带的也是这个UID。
+// Service、PodDisruptionBudget、NetworkPolicy和status.selector等所有选择Pod的地方都必须使用这组标签，而不是selectorLabels
+func (r *ApplicationReconciler) podSelector(ctx context.Context, app *v2.Application) (map[string]string, error) {
+	var live client.Object
+	switch workloadKind(app) {
+	case v2.WorkloadDeployment:
+		live = &appsv1.Deployment{}
+	case v2.WorkloadStatefulSet:
+		live = &appsv1.StatefulSet{}
+	default:
+		// Job和CronJob的selector由Job控制器生成，Pod模板总是带有控制器生成的选择器标签
+		return selectorLabels(app), nil
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, live); err != nil {
+		if errors.IsNotFound(err) {
+			return selectorLabels(app), nil
+		}
+		return nil, err
+	}
+	// 还没有被接管的同名工作负载的Pod不属于当前Application
+	if !metav1.IsControlledBy(live, app) {
+		return selectorLabels(app), nil
+	}
+	var selector *metav1.LabelSelector
+	switch live := live.(type) {
+	case *appsv1.Deployment:
+		selector = live.Spec.Selector
+	case *appsv1.StatefulSet:
+		selector = live.Spec.Selector
+	}
+	if selector == nil {
+		return selectorLabels(app), nil
+	}
+	return selector.MatchLabels, nil
+}
+
+// reconcileWorkload 根据spec.workload.kind生成Deployment、StatefulSet、Job或者CronJob
+func (r *ApplicationReconciler) reconcileWorkload(ctx context.Context, app *v2.Application) (ctrl.Result, error) {
+	switch workloadKind(app) {
+	case v2.WorkloadStatefulSet:
+		return r.reconcileStatefulSet(ctx, app)
+	case v2.WorkloadJob:
+		return r.reconcileJob(ctx, app)
+	case v2.WorkloadCronJob:
+		return r.reconcileCronJob(ctx, app)
+	default:
+		return r.reconcileDeployment(ctx, app)
+	}
+}
+
+// deleteOtherWorkloads 切换spec.workload.kind时，删除之前生成的其他类型的工作负载，并清理只属于它们的状态
+func (r *ApplicationReconciler) deleteOtherWorkloads(ctx context.Context, app *v2.Application) error {
+	log := log.FromContext(ctx)
+	kind := workloadKind(app)
+
+	var stale []client.Object
+	if kind != v2.WorkloadDeployment {
+		// 包括金丝雀版本和蓝绿发布的green Deployment
+		for _, name := range []string{app.Name, canaryName(app), greenName(app)} {
+			stale = append(stale, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: name}})
+		}
+		app.Status.Rollout = nil
+	}
+	if kind != v2.WorkloadStatefulSet {
+		// StatefulSet的PersistentVolumeClaim按照retention policy处理
+		stale = append(stale, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: app.Name}})
+	}
+	if kind != v2.WorkloadCronJob {
+		stale = append(stale, &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace, Name: app.Name}})
+	}
+	if kind != v2.WorkloadJob {
+		jobs, err := r.listJobs(ctx, app)
+		if err != nil {
+			return err
+		}
+		for i := range jobs {
+			stale = append(stale, &jobs[i])
+		}
+	}
+	if !batchEnabled(app) {
+		app.Status.Batch = nil
+	}
+
+	for _, obj := range stale {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !metav1.IsControlledBy(obj, app) {
+			continue
+		}
+		// Job默认不会级联删除它的Pod，统一使用后台级联删除
+		if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return err
+		}
+		log.Info("The workload has been replaced and deleted.", "workload", gvk.Kind+"/"+obj.GetName(), "kind", kind)
+	}
+	return nil
+}
@@ -19,14 +19,18 @@ package v1
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	appsv1 "github.com/wuyong7240/application-operator-plus/api/apps/v1"
+	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	webhookv2 "github.com/wuyong7240/application-operator-plus/internal/webhook/apps/v2"
 )
 
 // nolint:unused
@@ -38,6 +42,7 @@ func SetupApplicationWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).For(&appsv1.Application{}).
 		WithValidator(&ApplicationCustomValidator{
 			DefaultDeploymentReplicasMax: 10,
+			Client:                       mgr.GetClient(),
 		}).
 		WithDefaulter(&ApplicationCustomDefaulter{
 			DefaultDeploymentReplicas: 3,
@@ -103,12 +108,15 @@ func (d *ApplicationCustomDefaulter) Default(_ context.Context, obj runtime.Obje
 type ApplicationCustomValidator struct {
 	// TODO(user): Add more fields as needed for validation
 	DefaultDeploymentReplicasMax int32
+	// Client用于查询同一命名空间中的其他Application，以及检查请求者绑定角色的权限。
+	// 为空时跳过对其他Application的检查，但是拒绝绑定任何角色
+	Client client.Client
 }
 
 var _ webhook.CustomValidator = &ApplicationCustomValidator{}
 
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Application.
-func (v *ApplicationCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+func (v *ApplicationCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	application, ok := obj.(*appsv1.Application)
 	if !ok {
 		return nil, fmt.Errorf("expected a Application object but got %T", obj)
@@ -119,11 +127,14 @@ func (v *ApplicationCustomValidator) ValidateCreate(_ context.Context, obj runti
 	if err := v.validateApplication(application); err != nil {
 		return admission.Warnings{"Application Webhook v1 Errors!"}, err
 	}
-	return nil, nil
+	if err := v.authorizeRoleBindings(ctx, nil, application); err != nil {
+		return admission.Warnings{"Application Webhook v1 Errors!"}, err
+	}
+	return v.selectorOverlapWarnings(ctx, application)
 }
 
 // ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Application.
-func (v *ApplicationCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+func (v *ApplicationCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
 	application, ok := newObj.(*appsv1.Application)
 	if !ok {
 		return nil, fmt.Errorf("expected a Application object for the newObj but got %T", newObj)
@@ -134,8 +145,15 @@ func (v *ApplicationCustomValidator) ValidateUpdate(_ context.Context, oldObj, n
 	if err := v.validateApplication(application); err != nil {
 		return admission.Warnings{"Application Webhook v1 Errors!"}, err
 	}
+	old, ok := oldObj.(*appsv1.Application)
+	if !ok {
+		return nil, fmt.Errorf("expected a Application object for the oldObj but got %T", oldObj)
+	}
+	if err := v.authorizeRoleBindings(ctx, old, application); err != nil {
+		return admission.Warnings{"Application Webhook v1 Errors!"}, err
+	}
 
-	return nil, nil
+	return v.selectorOverlapWarnings(ctx, application)
 }
 
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Application.
@@ -160,3 +178,39 @@ func (v *ApplicationCustomValidator) validateApplication(application *appsv1.App
 	}
 	return nil
 }
+
+// authorizeRoleBindings v1对象通过注解携带spec.identity，同样需要检查请求者绑定角色的权限，old为空表示创建
+func (v *ApplicationCustomValidator) authorizeRoleBindings(ctx context.Context, old, application *appsv1.Application) error {
+	hub := &appsv2.Application{}
+	if err := application.ConvertTo(hub); err != nil {
+		return err
+	}
+	var oldHub *appsv2.Application
+	if old != nil {
+		oldHub = &appsv2.Application{}
+		if err := old.ConvertTo(oldHub); err != nil {
+			return err
+		}
+	}
+	return webhookv2.AuthorizeRoleBindings(ctx, v.Client, oldHub, hub)
+}
+
+// selectorOverlapWarnings 将Application转换为Hub版本后，复用v2 webhook中的重叠检查
+func (v *ApplicationCustomValidator) selectorOverlapWarnings(ctx context.Context, application *appsv1.Application) (admission.Warnings, error) {
+	if v.Client == nil {
+		return nil, nil
+	}
+	hub := &appsv2.Application{}
+	if err := application.ConvertTo(hub); err != nil {
+		return nil, err
+	}
+	overlaps, err := webhookv2.FindOverlappingApplications(ctx, v.Client, hub)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlaps) == 0 {
+		return nil, nil
+	}
+	return admission.Warnings{fmt.Sprintf("the selector of Application %s overlaps with Application(s) %s in namespace %s",
+		application.Name, strings.Join(overlaps, ", "), application.Namespace)}, nil
+}
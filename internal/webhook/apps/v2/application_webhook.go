@@ -19,15 +19,30 @@ package v2
 import (
 	"context"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	k8sappsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+	"github.com/wuyong7240/application-operator-plus/api/shared"
 )
 
 // nolint:unused
@@ -36,9 +51,17 @@ var applicationlog = logf.Log.WithName("application-resource")
 
 // SetupApplicationWebhookWithManager registers the webhook for Application in the manager.
 func SetupApplicationWebhookWithManager(mgr ctrl.Manager) error {
+	// scale子资源的请求不经过CustomValidator，单独注册一个处理Scale对象的webhook，v1和v2共用
+	mgr.GetWebhookServer().Register(ApplicationScalePath, &webhook.Admission{Handler: &ApplicationScaleValidator{
+		DefaultDeploymentReplicasMax: 10,
+		Decoder:                      admission.NewDecoder(mgr.GetScheme()),
+		Client:                       mgr.GetClient(),
+	}})
+
 	return ctrl.NewWebhookManagedBy(mgr).For(&appsv2.Application{}).
 		WithValidator(&ApplicationCustomValidator{
 			DefaultDeploymentReplicasMax: 10,
+			Client:                       mgr.GetClient(),
 		}).
 		WithDefaulter(&ApplicationCustomDefaulter{
 			DefaultDeploymentReplicas: 3,
@@ -75,11 +98,14 @@ func (d *ApplicationCustomDefaulter) Default(_ context.Context, obj runtime.Obje
 
 type ApplicationCustomValidator struct {
 	DefaultDeploymentReplicasMax int32
+	// Client用于查询同一命名空间中的其他Application，以及检查请求者绑定角色的权限。
+	// 为空时跳过对其他Application的检查，但是拒绝绑定任何角色
+	Client client.Client
 }
 
 var _ webhook.CustomValidator = &ApplicationCustomValidator{}
 
-func (v *ApplicationCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+func (v *ApplicationCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	application, ok := obj.(*appsv2.Application)
 	if !ok {
 		return nil, fmt.Errorf("expected an Application object but got %T", obj)
@@ -89,10 +115,16 @@ func (v *ApplicationCustomValidator) ValidateCreate(_ context.Context, obj runti
 	if err := v.validateApplication(application); err != nil {
 		return admission.Warnings{"Application Webhook v2 Errors!"}, err
 	}
-	return nil, nil
+	if err := v.validateDependencies(ctx, application); err != nil {
+		return admission.Warnings{"Application Webhook v2 Errors!"}, err
+	}
+	if err := AuthorizeRoleBindings(ctx, v.Client, nil, application); err != nil {
+		return admission.Warnings{"Application Webhook v2 Errors!"}, err
+	}
+	return v.selectorOverlapWarnings(ctx, application)
 }
 
-func (v *ApplicationCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+func (v *ApplicationCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
 	application, ok := newObj.(*appsv2.Application)
 	if !ok {
 		return nil, fmt.Errorf("expected an Application object but got %T", newObj)
@@ -102,7 +134,20 @@ func (v *ApplicationCustomValidator) ValidateUpdate(_ context.Context, oldObj, n
 	if err := v.validateApplication(application); err != nil {
 		return admission.Warnings{"Application Webhook v2 Errors!"}, err
 	}
-	return nil, nil
+	old, ok := oldObj.(*appsv2.Application)
+	if !ok {
+		return nil, fmt.Errorf("expected an Application object for the oldObj but got %T", oldObj)
+	}
+	if err := validateWorkloadUpdate(old, application); err != nil {
+		return admission.Warnings{"Application Webhook v2 Errors!"}, err
+	}
+	if err := v.validateDependencies(ctx, application); err != nil {
+		return admission.Warnings{"Application Webhook v2 Errors!"}, err
+	}
+	if err := AuthorizeRoleBindings(ctx, v.Client, old, application); err != nil {
+		return admission.Warnings{"Application Webhook v2 Errors!"}, err
+	}
+	return v.selectorOverlapWarnings(ctx, application)
 }
 
 func (v *ApplicationCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
@@ -119,8 +164,540 @@ func (v *ApplicationCustomValidator) ValidateDelete(ctx context.Context, obj run
 }
 
 func (v *ApplicationCustomValidator) validateApplication(application *appsv2.Application) error {
-	if *application.Spec.Workflow.Replicas > v.DefaultDeploymentReplicasMax {
+	// 开启自动扩缩容时spec.workflow.replicas会被忽略，上限检查作用于maxReplicas
+	if application.Spec.Autoscaling != nil {
+		if err := v.validateAutoscaling(application); err != nil {
+			return err
+		}
+	} else if *application.Spec.Workflow.Replicas > v.DefaultDeploymentReplicasMax {
 		return fmt.Errorf("replicas too many error")
 	}
+	if err := validateDisruption(application.Spec.Disruption); err != nil {
+		return err
+	}
+	if err := validateIngress(application); err != nil {
+		return err
+	}
+	if err := validateRoutes(application); err != nil {
+		return err
+	}
+	if err := validateConfig(application); err != nil {
+		return err
+	}
+	if err := validateIdentity(application.Spec.Identity); err != nil {
+		return err
+	}
+	if err := validateNetwork(application.Spec.Network); err != nil {
+		return err
+	}
+	if err := validateWorkload(application); err != nil {
+		return err
+	}
+	if err := v.validateComponents(application); err != nil {
+		return err
+	}
+	return validateRolloutStrategy(application.Spec.RolloutStrategy)
+}
+
+// validateIngress 检查spec.ingress能够找到要转发到的Service端口
+func validateIngress(application *appsv2.Application) error {
+	ingress := application.Spec.Ingress
+	if ingress == nil {
+		return nil
+	}
+	ports := application.Spec.Service.Ports
+	if ingress.ServicePort == nil {
+		if len(ports) == 0 {
+			return fmt.Errorf("spec.ingress: the Service has no ports to route traffic to")
+		}
+		return nil
+	}
+	for _, port := range ports {
+		if port.Name == ingress.ServicePort.String() || strconv.Itoa(int(port.Port)) == ingress.ServicePort.String() {
+			return nil
+		}
+	}
+	return fmt.Errorf("spec.ingress.servicePort: port %s is not defined in spec.service.ports", ingress.ServicePort.String())
+}
+
+// validateRoutes 检查spec.routes中的后端能够确定端口：指向其他Service的后端必须指定端口，
+// 使用默认端口时Application的Service至少要有一个端口
+func validateRoutes(application *appsv2.Application) error {
+	for i, route := range application.Spec.Routes {
+		rules := route.Rules
+		if len(rules) == 0 {
+			rules = []appsv2.HTTPRouteRule{{}}
+		}
+		for j, rule := range rules {
+			refs := rule.BackendRefs
+			if len(refs) == 0 {
+				refs = []appsv2.HTTPBackendRef{{}}
+			}
+			for k, ref := range refs {
+				if ref.Port != nil {
+					continue
+				}
+				if ref.Name != "" && ref.Name != application.Name {
+					return fmt.Errorf("spec.routes[%d].rules[%d].backendRefs[%d]: port is required for Service %s", i, j, k, ref.Name)
+				}
+				if len(application.Spec.Service.Ports) == 0 {
+					return fmt.Errorf("spec.routes[%d]: the Service has no ports to route traffic to", i)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateConfig 检查spec.config中的键能够写入ConfigMap，环境变量的名称合法，并且各个挂载目录互不相同
+func validateConfig(application *appsv2.Application) error {
+	mountPaths := map[string]string{}
+	if config := application.Spec.Config; config != nil {
+		for key := range config.Files {
+			if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+				return fmt.Errorf("spec.config.files: invalid key %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		for key := range config.Env {
+			if errs := validation.IsEnvVarName(key); len(errs) > 0 {
+				return fmt.Errorf("spec.config.env: invalid name %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		if len(config.Files) > 0 {
+			mountPaths[config.MountPath] = "spec.config.mountPath"
+		}
+	}
+	for i, ref := range application.Spec.Secrets {
+		if ref.MountPath == "" {
+			continue
+		}
+		if other, ok := mountPaths[ref.MountPath]; ok {
+			return fmt.Errorf("spec.secrets[%d].mountPath: %s is already used by %s", i, ref.MountPath, other)
+		}
+		mountPaths[ref.MountPath] = fmt.Sprintf("spec.secrets[%d]", i)
+	}
+	return nil
+}
+
+// validateIdentity 检查不创建ServiceAccount时指定了已有的ServiceAccount，并且同一个角色只绑定一次
+func validateIdentity(identity *appsv2.IdentitySpec) error {
+	if identity == nil {
+		return nil
+	}
+	if !identity.Create && identity.ServiceAccountName == "" {
+		return fmt.Errorf("spec.identity.serviceAccountName is required when create is false")
+	}
+	seen := map[appsv2.RoleReference]bool{}
+	for i, role := range identity.Roles {
+		if role.Kind == "" {
+			role.Kind = "Role"
+		}
+		if seen[role] {
+			return fmt.Errorf("spec.identity.roles[%d]: %s %s is bound more than once", i, role.Kind, role.Name)
+		}
+		seen[role] = true
+	}
+	return nil
+}
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// AuthorizeRoleBindings 检查发起请求的用户自己有权限绑定spec.identity.roles中的角色。控制器使用自己的bind权限创建RoleBinding，
+// 不做这个检查的话，能够创建Application的用户就可以把任意角色（例如cluster-admin）绑定到自己控制的ServiceAccount上。
+// 更新时只检查新增的角色，ServiceAccount发生变化时所有角色都会绑定到新的ServiceAccount上，需要全部检查
+func AuthorizeRoleBindings(ctx context.Context, c client.Client, old, application *appsv2.Application) error {
+	roles := rolesToAuthorize(old, application)
+	if len(roles) == 0 {
+		return nil
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("spec.identity.roles: cannot determine the requesting user: %w", err)
+	}
+	if c == nil {
+		return fmt.Errorf("spec.identity.roles: cannot verify that user %s may bind the roles", req.UserInfo.Username)
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	for _, role := range roles {
+		resource := "roles"
+		if role.Kind == "ClusterRole" {
+			resource = "clusterroles"
+		}
+		// RoleBinding引用ClusterRole时，API Server同样在RoleBinding所在的命名空间中检查bind权限
+		review := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   req.UserInfo.Username,
+			Groups: req.UserInfo.Groups,
+			UID:    req.UserInfo.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: application.Namespace,
+				Verb:      "bind",
+				Group:     rbacv1.GroupName,
+				Resource:  resource,
+				Name:      role.Name,
+			},
+		}}
+		if err := c.Create(ctx, review); err != nil {
+			return fmt.Errorf("spec.identity.roles: failed to review the permissions of user %s: %w", req.UserInfo.Username, err)
+		}
+		if !review.Status.Allowed {
+			return fmt.Errorf("spec.identity.roles: user %s is not allowed to bind %s %s in namespace %s",
+				req.UserInfo.Username, role.Kind, role.Name, application.Namespace)
+		}
+	}
+	return nil
+}
+
+// rolesToAuthorize 返回需要检查bind权限的角色，Kind已经补全了默认值
+func rolesToAuthorize(old, application *appsv2.Application) []appsv2.RoleReference {
+	if application.Spec.Identity == nil {
+		return nil
+	}
+	var granted []appsv2.RoleReference
+	if old != nil && old.Spec.Identity != nil && identityServiceAccount(old) == identityServiceAccount(application) {
+		granted = normalizeRoles(old.Spec.Identity.Roles)
+	}
+	var roles []appsv2.RoleReference
+	for _, role := range normalizeRoles(application.Spec.Identity.Roles) {
+		if !slices.Contains(granted, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// normalizeRoles 补全角色的Kind，未设置时与API的默认值保持一致
+func normalizeRoles(roles []appsv2.RoleReference) []appsv2.RoleReference {
+	normalized := make([]appsv2.RoleReference, 0, len(roles))
+	for _, role := range roles {
+		if role.Kind == "" {
+			role.Kind = "Role"
+		}
+		normalized = append(normalized, role)
+	}
+	return normalized
+}
+
+// identityServiceAccount 返回角色绑定到的ServiceAccount的名称，与控制器的计算方式保持一致
+func identityServiceAccount(application *appsv2.Application) string {
+	if application.Spec.Identity.ServiceAccountName != "" {
+		return application.Spec.Identity.ServiceAccountName
+	}
+	return application.Name
+}
+
+// validateNetwork 检查spec.network中的每个peer只描述了Application、命名空间和CIDR中的一种，并且CIDR合法
+func validateNetwork(network *appsv2.NetworkSpec) error {
+	if network == nil {
+		return nil
+	}
+	for _, direction := range []struct {
+		field string
+		peers []appsv2.NetworkPeer
+	}{{"ingressFrom", network.IngressFrom}, {"egressTo", network.EgressTo}} {
+		for i, peer := range direction.peers {
+			path := fmt.Sprintf("spec.network.%s[%d]", direction.field, i)
+			if peer.CIDR == "" {
+				if peer.Application == "" && peer.Namespace == "" {
+					return fmt.Errorf("%s: one of application, namespace and cidr must be set", path)
+				}
+				if len(peer.Except) > 0 {
+					return fmt.Errorf("%s: except can only be used with cidr", path)
+				}
+				continue
+			}
+			if peer.Application != "" || peer.Namespace != "" {
+				return fmt.Errorf("%s: cidr cannot be combined with application or namespace", path)
+			}
+			for _, cidr := range append([]string{peer.CIDR}, peer.Except...) {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateWorkload 检查StatefulSet、Job和CronJob没有与只支持Deployment的发布策略和自动扩缩容一起使用，
+// 并检查CronJob的调度配置
+func validateWorkload(application *appsv2.Application) error {
+	workload := application.Spec.Workload
+	if workload == nil || workload.Kind == "" || workload.Kind == appsv2.WorkloadDeployment {
+		return nil
+	}
+	if application.Spec.RolloutStrategy != nil {
+		return fmt.Errorf("spec.rolloutStrategy cannot be used with a %s workload", workload.Kind)
+	}
+	if application.Spec.Autoscaling != nil {
+		return fmt.Errorf("spec.autoscaling cannot be used with a %s workload", workload.Kind)
+	}
+	if workload.Kind == appsv2.WorkloadStatefulSet {
+		return nil
+	}
+
+	// Job和CronJob的Pod运行结束后就会退出，PodDisruptionBudget对它们没有意义
+	if application.Spec.Disruption != nil {
+		return fmt.Errorf("spec.disruption cannot be used with a %s workload", workload.Kind)
+	}
+	if workload.Kind == appsv2.WorkloadCronJob {
+		if workload.CronJob == nil || workload.CronJob.Schedule == "" {
+			return fmt.Errorf("spec.workload.cronJob.schedule is required for a CronJob workload")
+		}
+		if tz := workload.CronJob.TimeZone; tz != nil {
+			if _, err := time.LoadLocation(*tz); err != nil {
+				return fmt.Errorf("spec.workload.cronJob.timeZone: unknown time zone %q", *tz)
+			}
+		}
+	}
+	return nil
+}
+
+// validateWorkloadUpdate 检查StatefulSet中不可变的字段没有被修改，否则控制器将无法更新StatefulSet
+func validateWorkloadUpdate(old, application *appsv2.Application) error {
+	oldTemplate, newTemplate := statefulSetTemplate(old), statefulSetTemplate(application)
+	if oldTemplate == nil || newTemplate == nil {
+		return nil
+	}
+	if !equality.Semantic.DeepEqual(oldTemplate.VolumeClaimTemplates, newTemplate.VolumeClaimTemplates) {
+		return fmt.Errorf("spec.workload.statefulSet.volumeClaimTemplates cannot be changed")
+	}
+	if oldTemplate.PodManagementPolicy != newTemplate.PodManagementPolicy {
+		return fmt.Errorf("spec.workload.statefulSet.podManagementPolicy cannot be changed")
+	}
 	return nil
 }
+
+// statefulSetTemplate 返回以StatefulSet运行的Application的StatefulSet模板，其他情况返回nil
+func statefulSetTemplate(application *appsv2.Application) *appsv2.StatefulSetTemplate {
+	workload := application.Spec.Workload
+	if workload == nil || workload.Kind != appsv2.WorkloadStatefulSet {
+		return nil
+	}
+	if workload.StatefulSet == nil {
+		return &appsv2.StatefulSetTemplate{}
+	}
+	return workload.StatefulSet
+}
+
+// validateDependencies 检查spec.dependsOn没有引用Application自身，并且沿着已有Application的spec.dependsOn
+// 不会回到它自己，否则这些Application会互相等待而永远无法创建工作负载。Client为空时只检查自身引用
+func (v *ApplicationCustomValidator) validateDependencies(ctx context.Context, application *appsv2.Application) error {
+	self := types.NamespacedName{Namespace: application.Namespace, Name: application.Name}
+	for i, ref := range application.Spec.DependsOn {
+		if dependencyKey(application, ref) == self {
+			return fmt.Errorf("spec.dependsOn[%d]: an Application cannot depend on itself", i)
+		}
+	}
+	if v.Client == nil {
+		return nil
+	}
+
+	visited := map[types.NamespacedName]bool{}
+	var visit func(key types.NamespacedName, path []string) error
+	visit = func(key types.NamespacedName, path []string) error {
+		path = append(slices.Clip(path), key.String())
+		if key == self {
+			return fmt.Errorf("spec.dependsOn: circular dependency %s", strings.Join(path, " -> "))
+		}
+		if visited[key] {
+			return nil
+		}
+		visited[key] = true
+
+		dep := &appsv2.Application{}
+		if err := v.Client.Get(ctx, key, dep); err != nil {
+			// 尚未创建的Application没有依赖，等它创建时再检查
+			return client.IgnoreNotFound(err)
+		}
+		for _, ref := range dep.Spec.DependsOn {
+			if err := visit(dependencyKey(dep, ref), path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, ref := range application.Spec.DependsOn {
+		if err := visit(dependencyKey(application, ref), []string{self.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependencyKey 返回spec.dependsOn引用的Application，命名空间默认与当前Application相同
+func dependencyKey(application *appsv2.Application, ref appsv2.ApplicationReference) types.NamespacedName {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = application.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}
+}
+
+// reservedComponentNames 是控制器为主工作负载生成的子资源使用的名称后缀，组件不能使用它们
+var reservedComponentNames = []string{"canary", "green", "preview", "headless"}
+
+// validateComponents 检查组件生成的子资源名称合法，不与主工作负载的子资源重名，并且副本数不超过上限
+func (v *ApplicationCustomValidator) validateComponents(application *appsv2.Application) error {
+	for i, component := range application.Spec.Components {
+		field := fmt.Sprintf("spec.components[%d]", i)
+		if slices.Contains(reservedComponentNames, component.Name) {
+			return fmt.Errorf("%s.name: %q is reserved for the children of spec.workflow", field, component.Name)
+		}
+		if errs := validation.IsDNS1035Label(application.Name + "-" + component.Name); len(errs) > 0 {
+			return fmt.Errorf("%s.name: the children would be named %s-%s: %s", field, application.Name, component.Name, strings.Join(errs, ", "))
+		}
+		if replicas := component.Workflow.Replicas; replicas != nil && *replicas > v.DefaultDeploymentReplicasMax {
+			return fmt.Errorf("%s.workflow.replicas too many error", field)
+		}
+	}
+	return nil
+}
+
+// validateDisruption 检查spec.disruption中minAvailable和maxUnavailable最多只设置了一个
+func validateDisruption(disruption *appsv2.DisruptionSpec) error {
+	if disruption != nil && disruption.MinAvailable != nil && disruption.MaxUnavailable != nil {
+		return fmt.Errorf("spec.disruption: minAvailable and maxUnavailable cannot be set together")
+	}
+	return nil
+}
+
+// validateAutoscaling 检查spec.autoscaling的副本数范围，并且不能与蓝绿发布同时使用
+func (v *ApplicationCustomValidator) validateAutoscaling(application *appsv2.Application) error {
+	autoscaling := application.Spec.Autoscaling
+	if autoscaling.MaxReplicas > v.DefaultDeploymentReplicasMax {
+		return fmt.Errorf("spec.autoscaling.maxReplicas too many error")
+	}
+	if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+		return fmt.Errorf("spec.autoscaling.minReplicas must not be greater than maxReplicas")
+	}
+	if strategy := application.Spec.RolloutStrategy; strategy != nil && strategy.BlueGreen != nil {
+		return fmt.Errorf("spec.autoscaling cannot be used together with spec.rolloutStrategy.blueGreen")
+	}
+	return nil
+}
+
+// validateRolloutStrategy 检查只配置了一种发布方式，并且金丝雀发布的每一步都只设置了setWeight和pause中的一个
+func validateRolloutStrategy(strategy *appsv2.RolloutStrategy) error {
+	if strategy == nil {
+		return nil
+	}
+	if strategy.Canary != nil && strategy.BlueGreen != nil {
+		return fmt.Errorf("spec.rolloutStrategy: canary and blueGreen cannot be used together")
+	}
+	if strategy.Canary == nil {
+		return nil
+	}
+	for i, step := range strategy.Canary.Steps {
+		if (step.SetWeight == nil) == (step.Pause == nil) {
+			return fmt.Errorf("spec.rolloutStrategy.canary.steps[%d]: exactly one of setWeight and pause must be set", i)
+		}
+	}
+	return nil
+}
+
+// selectorOverlapWarnings 检查同一命名空间中是否有其他Application的Pod与当前Application的Pod被对方的工作负载选中。
+// 只有沿用旧selector的工作负载才可能选中其他Application的Pod，控制器不会因此出错，但是工作负载会互相争抢Pod，
+// 因此只返回警告而不拒绝请求
+func (v *ApplicationCustomValidator) selectorOverlapWarnings(ctx context.Context, application *appsv2.Application) (admission.Warnings, error) {
+	if v.Client == nil {
+		return nil, nil
+	}
+	overlaps, err := FindOverlappingApplications(ctx, v.Client, application)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlaps) == 0 {
+		return nil, nil
+	}
+	return admission.Warnings{fmt.Sprintf("the selector of Application %s overlaps with Application(s) %s in namespace %s",
+		application.Name, strings.Join(overlaps, ", "), application.Namespace)}, nil
+}
+
+// FindOverlappingApplications 返回同一命名空间中与app的Pod互相被对方选中的其他Application的名称。
+// 比较的是控制器实际使用的selector：新建的Deployment和StatefulSet使用包含Application UID的生成标签，它们之间不会重叠；
+// 升级前创建或者被接管的工作负载沿用它们不可变的旧selector（例如app: application），可能选中其他Application的Pod
+func FindOverlappingApplications(ctx context.Context, c client.Reader, app *appsv2.Application) ([]string, error) {
+	list := &appsv2.ApplicationList{}
+	if err := c.List(ctx, list, client.InNamespace(app.Namespace)); err != nil {
+		return nil, err
+	}
+
+	self, err := workloadSelector(ctx, c, app)
+	if err != nil {
+		return nil, err
+	}
+	var overlaps []string
+	for i := range list.Items {
+		other := &list.Items[i]
+		if other.Name == app.Name {
+			continue
+		}
+		selector, err := workloadSelector(ctx, c, other)
+		if err != nil {
+			return nil, err
+		}
+		if selectsPodsOf(self, podLabels(other, selector)) || selectsPodsOf(selector, podLabels(app, self)) {
+			overlaps = append(overlaps, other.Name)
+		}
+	}
+	return overlaps, nil
+}
+
+// workloadSelector 返回控制器为Application的工作负载使用的selector：已经存在的Deployment或者StatefulSet沿用它当前的selector，
+// 否则使用生成的选择器标签，与控制器的计算方式保持一致
+func workloadSelector(ctx context.Context, c client.Reader, app *appsv2.Application) (*metav1.LabelSelector, error) {
+	key := types.NamespacedName{Namespace: app.Namespace, Name: app.Name}
+	if statefulSetTemplate(app) != nil {
+		sts := &k8sappsv1.StatefulSet{}
+		if err := c.Get(ctx, key, sts); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		} else if err == nil && sts.Spec.Selector != nil {
+			return sts.Spec.Selector, nil
+		}
+	} else {
+		dp := &k8sappsv1.Deployment{}
+		if err := c.Get(ctx, key, dp); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		} else if err == nil && dp.Spec.Selector != nil {
+			return dp.Spec.Selector, nil
+		}
+	}
+	return &metav1.LabelSelector{MatchLabels: generatedSelectorLabels(app)}, nil
+}
+
+// generatedSelectorLabels 返回控制器生成的选择器标签。创建时Application还没有UID，只有实例名称参与比较
+func generatedSelectorLabels(app *appsv2.Application) map[string]string {
+	generated := map[string]string{shared.LabelInstance: app.Name}
+	if app.UID != "" {
+		generated[shared.LabelApplicationUID] = string(app.UID)
+	}
+	return generated
+}
+
+// podLabels 返回Application的Pod上的标签：Pod模板中声明的标签，加上控制器生成的选择器标签和工作负载selector要求的标签
+func podLabels(app *appsv2.Application, selector *metav1.LabelSelector) labels.Set {
+	set := labels.Set{}
+	for k, v := range app.Spec.Workflow.Template.Labels {
+		set[k] = v
+	}
+	for k, v := range generatedSelectorLabels(app) {
+		set[k] = v
+	}
+	for k, v := range selector.MatchLabels {
+		set[k] = v
+	}
+	return set
+}
+
+// selectsPodsOf 判断selector是否能够匹配Pod标签，空selector不参与比较
+func selectsPodsOf(selector *metav1.LabelSelector, podLabels labels.Set) bool {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || sel.Empty() {
+		return false
+	}
+	return sel.Matches(podLabels)
+}
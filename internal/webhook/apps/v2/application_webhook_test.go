@@ -17,13 +17,43 @@ limitations under the License.
 package v2
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	admissionv1 "k8s.io/api/admission/v1"
+	k8sappsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
 	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
-	// TODO (user): Add any additional imports if needed
 )
 
+// newApplication 构造一个用于测试的Application，labels同时作为selector和Pod模板标签
+func newApplication(name string, labels map[string]string) *appsv2.Application {
+	replicas := int32(1)
+	app := &appsv2.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+	}
+	app.Spec.Workflow.Replicas = &replicas
+	app.Spec.Workflow.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	app.Spec.Workflow.Template.Labels = labels
+	return app
+}
+
 var _ = Describe("Application Webhook", func() {
 	var (
 		obj    *appsv2.Application
@@ -42,6 +72,399 @@ var _ = Describe("Application Webhook", func() {
 		// TODO (user): Add any teardown logic common to all tests
 	})
 
+	Context("When creating or updating Application under Validating Webhook", func() {
+		ctx := context.Background()
+
+		newValidator := func(existing ...client.Object) *ApplicationCustomValidator {
+			scheme := runtime.NewScheme()
+			Expect(appsv2.AddToScheme(scheme)).To(Succeed())
+			Expect(k8sappsv1.AddToScheme(scheme)).To(Succeed())
+			Expect(authorizationv1.AddToScheme(scheme)).To(Succeed())
+			// 模拟API Server的鉴权：admin可以绑定任意角色，其他用户只能绑定名为reader的Role
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+					attrs := review.Spec.ResourceAttributes
+					review.Status.Allowed = review.Spec.User == "admin" ||
+						(attrs.Verb == "bind" && attrs.Resource == "roles" && attrs.Name == "reader")
+					return nil
+				},
+			})
+			builder = builder.WithObjects(existing...)
+			return &ApplicationCustomValidator{DefaultDeploymentReplicasMax: 10, Client: builder.Build()}
+		}
+
+		It("Should warn when a legacy selector selects the pods of another Application", func() {
+			other := newApplication("other", map[string]string{"app": "application"})
+			legacy := &k8sappsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+				Spec: k8sappsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "application"}},
+				},
+			}
+			validator := newValidator(other, legacy)
+			obj = newApplication("sample", map[string]string{"app": "application"})
+
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(ContainSubstring("other"))
+		})
+
+		It("Should not warn when only spec.workflow.selector overlaps", func() {
+			validator := newValidator(newApplication("other", map[string]string{"app": "application"}))
+			obj = newApplication("sample", map[string]string{"app": "application"})
+
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("Should not compare an Application with itself on update", func() {
+			oldObj = newApplication("sample", map[string]string{"app": "sample"})
+			validator := newValidator(oldObj)
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+
+			warnings, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("Should require exactly one of setWeight and pause in each canary step", func() {
+			validator := newValidator()
+			weight := int32(20)
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.RolloutStrategy = &appsv2.RolloutStrategy{Canary: &appsv2.CanaryStrategy{
+				Steps: []appsv2.CanaryStep{{SetWeight: &weight}, {Pause: &appsv2.CanaryPause{}}},
+			}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.RolloutStrategy.Canary.Steps = append(obj.Spec.RolloutStrategy.Canary.Steps,
+				appsv2.CanaryStep{SetWeight: &weight, Pause: &appsv2.CanaryPause{}})
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("steps[2]")))
+
+			obj.Spec.RolloutStrategy.Canary.Steps = []appsv2.CanaryStep{{}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("steps[0]")))
+		})
+
+		It("Should reject combining the canary and blue/green strategies", func() {
+			validator := newValidator()
+			weight := int32(50)
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.RolloutStrategy = &appsv2.RolloutStrategy{BlueGreen: &appsv2.BlueGreenStrategy{AutoPromotion: true}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.RolloutStrategy.Canary = &appsv2.CanaryStrategy{Steps: []appsv2.CanaryStep{{SetWeight: &weight}}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("cannot be used together")))
+		})
+
+		It("Should check maxReplicas instead of replicas when autoscaling is enabled", func() {
+			validator := newValidator()
+			replicas := int32(20)
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Workflow.Replicas = &replicas
+			obj.Spec.Autoscaling = &appsv2.AutoscalingSpec{MaxReplicas: 5}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Autoscaling.MaxReplicas = 20
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("maxReplicas")))
+		})
+
+		It("Should reject setting both minAvailable and maxUnavailable", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Disruption = &appsv2.DisruptionSpec{MinAvailable: ptr.To(intstr.FromInt32(1))}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Disruption.MaxUnavailable = ptr.To(intstr.FromString("25%"))
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.disruption")))
+		})
+
+		It("Should require the Ingress service port to exist on the Service", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Ingress = &appsv2.IngressSpec{Hosts: []appsv2.IngressHost{{Host: "sample.example.com"}}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("no ports")))
+
+			obj.Spec.Service.Ports = []corev1.ServicePort{{Name: "http", Port: 80}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Ingress.ServicePort = ptr.To(intstr.FromString("http"))
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Ingress.ServicePort = ptr.To(intstr.FromInt32(8080))
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("8080")))
+		})
+
+		It("Should require a port for every route backend", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Routes = []appsv2.HTTPRouteSpec{{Name: "public", ParentRefs: []appsv2.RouteParentRef{{Name: "gateway"}}}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("no ports")))
+
+			obj.Spec.Service.Ports = []corev1.ServicePort{{Name: "http", Port: 80}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Routes[0].Rules = []appsv2.HTTPRouteRule{{BackendRefs: []appsv2.HTTPBackendRef{
+				{Weight: ptr.To[int32](90)},
+				{Name: "sample-v2", Weight: ptr.To[int32](10)},
+			}}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("port is required")))
+
+			obj.Spec.Routes[0].Rules[0].BackendRefs[1].Port = ptr.To[int32](8080)
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should validate the generated configuration", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Config = &appsv2.ConfigSpec{
+				Files:     map[string]string{"app.yaml": "debug: true"},
+				Env:       map[string]string{"LOG_LEVEL": "info"},
+				MountPath: "/etc/config",
+			}
+			obj.Spec.Secrets = []appsv2.SecretReference{{Name: "tls", MountPath: "/etc/tls"}, {Name: "credentials"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Config.Env["LOG=LEVEL"] = "debug"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.config.env")))
+			delete(obj.Spec.Config.Env, "LOG=LEVEL")
+
+			obj.Spec.Secrets[0].MountPath = "/etc/config"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("already used")))
+		})
+
+		It("Should validate the identity", func() {
+			validator := newValidator()
+			ctx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "admin"},
+			}})
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Identity = &appsv2.IdentitySpec{}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("serviceAccountName is required")))
+
+			obj.Spec.Identity.Create = true
+			obj.Spec.Identity.Roles = []appsv2.RoleReference{{Name: "reader"}, {Kind: "ClusterRole", Name: "reader"}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Identity.Roles = append(obj.Spec.Identity.Roles, appsv2.RoleReference{Kind: "Role", Name: "reader"})
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("more than once")))
+		})
+
+		It("Should reject binding roles the requesting user may not bind", func() {
+			validator := newValidator()
+			developer := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "developer"},
+			}})
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Identity = &appsv2.IdentitySpec{Create: true, Roles: []appsv2.RoleReference{{Name: "reader"}}}
+			_, err := validator.ValidateCreate(developer, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Identity.Roles = append(obj.Spec.Identity.Roles, appsv2.RoleReference{Kind: "ClusterRole", Name: "cluster-admin"})
+			_, err = validator.ValidateCreate(developer, obj)
+			Expect(err).To(MatchError(ContainSubstring("user developer is not allowed to bind ClusterRole cluster-admin")))
+
+			By("Only checking the roles added by an update")
+			oldObj = obj.DeepCopy()
+			obj.Spec.Workflow.Replicas = ptr.To[int32](2)
+			_, err = validator.ValidateUpdate(developer, oldObj, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking all roles when they are bound to another ServiceAccount")
+			obj.Spec.Identity.ServiceAccountName = "other"
+			_, err = validator.ValidateUpdate(developer, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("cluster-admin")))
+
+			By("Rejecting roles when the requesting user is unknown")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("cannot determine the requesting user")))
+		})
+
+		It("Should validate the network peers", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Network = &appsv2.NetworkSpec{
+				IngressFrom: []appsv2.NetworkPeer{{Application: "frontend"}, {Namespace: "monitoring"}},
+				EgressTo:    []appsv2.NetworkPeer{{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Network.EgressTo[0].Except = []string{"10.1.0.0"}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.network.egressTo[0]")))
+
+			obj.Spec.Network.EgressTo = nil
+			obj.Spec.Network.IngressFrom = append(obj.Spec.Network.IngressFrom, appsv2.NetworkPeer{Application: "batch", CIDR: "10.0.0.0/8"})
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("cannot be combined")))
+		})
+
+		It("Should reject Deployment only features and immutable changes for StatefulSets", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Workload = &appsv2.WorkloadSpec{
+				Kind:        appsv2.WorkloadStatefulSet,
+				StatefulSet: &appsv2.StatefulSetTemplate{PodManagementPolicy: k8sappsv1.OrderedReadyPodManagement},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Autoscaling = &appsv2.AutoscalingSpec{MaxReplicas: 5}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("StatefulSet")))
+			obj.Spec.Autoscaling = nil
+
+			oldObj = obj.DeepCopy()
+			obj.Spec.Workload.StatefulSet.PodManagementPolicy = k8sappsv1.ParallelPodManagement
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("podManagementPolicy cannot be changed")))
+		})
+
+		It("Should reject self and circular dependencies", func() {
+			api := newApplication("api", map[string]string{"app": "api"})
+			api.Spec.DependsOn = []appsv2.ApplicationReference{{Name: "migration"}}
+			migration := newApplication("migration", map[string]string{"app": "migration"})
+			migration.Spec.DependsOn = []appsv2.ApplicationReference{{Name: "database", Namespace: "data"}}
+			validator := newValidator(api, migration)
+
+			obj = newApplication("database", map[string]string{"app": "database"})
+			obj.Namespace = "data"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.DependsOn = []appsv2.ApplicationReference{{Name: "database"}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("cannot depend on itself")))
+
+			obj.Spec.DependsOn = []appsv2.ApplicationReference{{Name: "api", Namespace: "default"}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("data/database -> default/api -> default/migration -> data/database")))
+		})
+
+		It("Should reject reserved, too long and oversized components", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Components = []appsv2.ComponentSpec{{Name: "api"}, {Name: "worker"}}
+			obj.Spec.Components[0].Workflow.Replicas = ptr.To[int32](2)
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Components[0].Workflow.Replicas = ptr.To[int32](20)
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.components[0].workflow.replicas")))
+			obj.Spec.Components[0].Workflow.Replicas = nil
+
+			obj.Spec.Components[1].Name = "canary"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("is reserved")))
+
+			obj.Spec.Components[1].Name = strings.Repeat("w", 60)
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.components[1].name")))
+		})
+
+		It("Should require a schedule for CronJobs and reject Deployment only features for Jobs", func() {
+			validator := newValidator()
+			obj = newApplication("sample", map[string]string{"app": "sample"})
+			obj.Spec.Workload = &appsv2.WorkloadSpec{Kind: appsv2.WorkloadCronJob}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.workload.cronJob.schedule is required")))
+
+			obj.Spec.Workload.CronJob = &appsv2.CronJobTemplate{Schedule: "*/5 * * * *", TimeZone: ptr.To("Mars/Olympus")}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("unknown time zone")))
+
+			obj.Spec.Workload.CronJob.TimeZone = ptr.To("Asia/Shanghai")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Workload = &appsv2.WorkloadSpec{Kind: appsv2.WorkloadJob}
+			obj.Spec.Disruption = &appsv2.DisruptionSpec{}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.disruption cannot be used with a Job workload")))
+		})
+	})
+
+	Context("When scaling Application through the scale subresource", func() {
+		It("Should deny scale requests above the replicas limit", func() {
+			scheme := runtime.NewScheme()
+			Expect(autoscalingv1.AddToScheme(scheme)).To(Succeed())
+			validator := &ApplicationScaleValidator{DefaultDeploymentReplicasMax: 10, Decoder: admission.NewDecoder(scheme)}
+
+			request := func(replicas int32) admission.Request {
+				raw, err := json.Marshal(&autoscalingv1.Scale{
+					TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v1", Kind: "Scale"},
+					Spec:     autoscalingv1.ScaleSpec{Replicas: replicas},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:   "sample",
+					Object: runtime.RawExtension{Raw: raw},
+				}}
+			}
+
+			ctx := context.Background()
+			Expect(validator.Handle(ctx, request(5)).Allowed).To(BeTrue())
+			resp := validator.Handle(ctx, request(20))
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("replicas too many"))
+		})
+
+		It("Should deny scale requests while autoscaling is enabled", func() {
+			scheme := runtime.NewScheme()
+			Expect(autoscalingv1.AddToScheme(scheme)).To(Succeed())
+			Expect(appsv2.AddToScheme(scheme)).To(Succeed())
+			app := newApplication("sample", map[string]string{"app": "sample"})
+			app.Spec.Autoscaling = &appsv2.AutoscalingSpec{MaxReplicas: 5}
+			validator := &ApplicationScaleValidator{
+				DefaultDeploymentReplicasMax: 10,
+				Decoder:                      admission.NewDecoder(scheme),
+				Client:                       fake.NewClientBuilder().WithScheme(scheme).WithObjects(app).Build(),
+			}
+
+			raw, err := json.Marshal(&autoscalingv1.Scale{
+				TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v1", Kind: "Scale"},
+				Spec:     autoscalingv1.ScaleSpec{Replicas: 3},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resp := validator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Name:      "sample",
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(resp.Result.Message).To(ContainSubstring("spec.autoscaling is enabled"))
+		})
+	})
+
 	Context("When creating Application under Conversion Webhook", func() {
 		// TODO (user): Add logic to convert the object to the desired version and verify the conversion
 		// Example:
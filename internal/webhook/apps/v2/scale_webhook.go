@@ -0,0 +1,73 @@
+/*
+Copyright 2025 wuyong.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv2 "github.com/wuyong7240/application-operator-plus/api/apps/v2"
+)
+
+// ApplicationScalePath is the path the webhook for the scale subresource of Application is served at.
+const ApplicationScalePath = "/validate-apps-wuyong-cn-application-scale"
+
+// +kubebuilder:webhook:path=/validate-apps-wuyong-cn-application-scale,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps.wuyong.cn,resources=applications/scale,verbs=update,versions=v1;v2,name=vapplication-scale.kb.io,admissionReviewVersions=v1,matchPolicy=Exact
+
+// ApplicationScaleValidator validates the requests to the scale subresource of Application, e.g. from
+// kubectl scale or an autoscaler targeting the Application. They carry an autoscaling/v1 Scale instead
+// of an Application, so they are not seen by ApplicationCustomValidator.
+type ApplicationScaleValidator struct {
+	DefaultDeploymentReplicasMax int32
+	Decoder                      admission.Decoder
+	// Client用于读取被扩缩容的Application，为空时跳过相关检查
+	Client client.Reader
+}
+
+var _ admission.Handler = &ApplicationScaleValidator{}
+
+// Handle implements admission.Handler.
+func (v *ApplicationScaleValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	scale := &autoscalingv1.Scale{}
+	if err := v.Decoder.Decode(req, scale); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	applicationlog.Info("Validation for Application upon scale", "name", req.Name, "replicas", scale.Spec.Replicas)
+
+	// 与直接修改spec.workflow.replicas时的上限保持一致
+	if scale.Spec.Replicas > v.DefaultDeploymentReplicasMax {
+		return admission.Denied(fmt.Sprintf("replicas too many error: %d exceeds the maximum of %d", scale.Spec.Replicas, v.DefaultDeploymentReplicasMax))
+	}
+
+	// 开启自动扩缩容时控制器会忽略spec.workflow.replicas，扩缩容请求不会生效，直接拒绝而不是静默忽略
+	if v.Client != nil {
+		application := &appsv2.Application{}
+		if err := v.Client.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: req.Name}, application); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if application.Spec.Autoscaling != nil {
+			return admission.Denied("spec.autoscaling is enabled, the replicas are managed by the HorizontalPodAutoscaler of the Application")
+		}
+	}
+	return admission.Allowed("")
+}